@@ -23,11 +23,13 @@ func main() {
 	var testConfig bool   // Test config and exit
 	var showVersion bool  // Show version information
 	var showHelp bool     // Show help message
+	var watchConfig bool  // Reload configuration on changes
 
 	flag.StringVarP(&configPath, "config", "c", "", "path to configuration file")
 	flag.BoolVarP(&showVersion, "version", "v", false, "show version information")
 	flag.BoolVarP(&showHelp, "help", "h", false, "show help message")
 	flag.BoolVarP(&testConfig, "test", "t", false, "test config and exit")
+	flag.BoolVarP(&watchConfig, "watch", "w", false, "reload configuration when its file changes")
 	flag.Parse()
 
 	if showHelp {
@@ -41,21 +43,10 @@ func main() {
 	}
 
 	// Load configuration
-	var cfg config.Config
-	var err error
-
-	if configPath != "" {
-		err = cfg.LoadFromPath(configPath)
-		if err != nil {
-			fmt.Printf("error loading configuration from %s: %v\n", configPath, err)
-			os.Exit(exitBadConfig)
-		}
-	} else {
-		err = cfg.Load()
-		if err != nil {
-			fmt.Printf("error loading configuration: %v\n", err)
-			os.Exit(exitBadConfig)
-		}
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(exitBadConfig)
 	}
 
 	// Validate
@@ -79,10 +70,62 @@ func main() {
 		os.Exit(exitErr)
 	}
 
+	var changes <-chan struct{}
+	if watchConfig {
+		watcher, err := config.Watch(cfg.Path())
+		if err != nil {
+			fmt.Printf("error watching configuration: %v\n", err)
+			application.Shutdown()
+			os.Exit(exitErr)
+		}
+		defer watcher.Close()
+		changes = watcher.Changes()
+	}
+
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	for {
+		select {
+		case sig := <-sigChan:
+			if sig != syscall.SIGHUP {
+				application.Shutdown()
+				return
+			}
+		case <-changes:
+		}
+		reload(application, configPath)
+	}
+}
 
-	<-sigChan
+func loadConfig(path string) (config.Config, error) {
+	var cfg config.Config
+	if path != "" {
+		err := cfg.LoadFromPath(path)
+		if err != nil {
+			return cfg, fmt.Errorf("error loading configuration from %s: %w", path, err)
+		}
+	} else {
+		err := cfg.Load()
+		if err != nil {
+			return cfg, fmt.Errorf("error loading configuration: %w", err)
+		}
+	}
+	return cfg, nil
+}
 
-	application.Shutdown()
+// Apply the configuration as it is now, keeping the current one if it is
+// invalid
+func reload(application *app.Application, path string) {
+	logger := application.Logger()
+	cfg, err := loadConfig(path)
+	if err != nil {
+		logger.Errorf("%v, keeping current configuration", err)
+		return
+	}
+	if errs, ok := cfg.Validate(); !ok {
+		logger.Errorf("invalid configuration, keeping current one:\n%v", errs)
+		return
+	}
+	application.Reload(cfg)
 }
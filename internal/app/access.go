@@ -0,0 +1,144 @@
+package app
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/valyala/bytebufferpool"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	accessLogCommon   = "common"
+	accessLogCombined = "combined"
+	accessLogExtended = "extended"
+	accessLogJSON     = "json"
+
+	// User value of requests answered from a listing, "hit" or "miss"
+	cacheStatusKey = "cache_status"
+)
+
+// Writes a line per request to out
+type accessLogger struct {
+	format string
+	out    io.Writer
+}
+
+type accessLogEntry struct {
+	Time      string  `json:"time"`
+	ClientIP  string  `json:"client_ip"`
+	Method    string  `json:"method"`
+	Path      string  `json:"path"`
+	Query     string  `json:"query,omitempty"`
+	Protocol  string  `json:"protocol"`
+	Status    int     `json:"status"`
+	Bytes     int     `json:"bytes"`
+	Latency   float64 `json:"latency"` // Seconds
+	Cache     string  `json:"cache,omitempty"`
+	Referer   string  `json:"referer,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+}
+
+// Wraps handler to log requests to it
+func (l *accessLogger) instrument(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		handler(ctx)
+		l.log(ctx, start, time.Since(start))
+	}
+}
+
+func (l *accessLogger) log(ctx *fasthttp.RequestCtx, start time.Time, latency time.Duration) {
+	cache, _ := ctx.UserValue(cacheStatusKey).(string)
+
+	bb := bytebufferpool.Get()
+	defer bytebufferpool.Put(bb)
+
+	if l.format == accessLogJSON {
+		data, err := sonic.Marshal(accessLogEntry{
+			Time:      start.UTC().Format(time.RFC3339Nano),
+			ClientIP:  ctx.RemoteIP().String(),
+			Method:    string(ctx.Method()),
+			Path:      string(ctx.Path()),
+			Query:     string(ctx.QueryArgs().QueryString()),
+			Protocol:  string(ctx.Request.Header.Protocol()),
+			Status:    ctx.Response.StatusCode(),
+			Bytes:     responseBytes(ctx),
+			Latency:   latency.Seconds(),
+			Cache:     cache,
+			Referer:   string(ctx.Referer()),
+			UserAgent: string(ctx.UserAgent()),
+		})
+		if err != nil {
+			return
+		}
+		bb.Write(data)
+		bb.WriteByte('\n')
+		bb.WriteTo(l.out)
+		return
+	}
+
+	// host ident authuser [date] "request" status bytes
+	bb.WriteString(ctx.RemoteIP().String())
+	bb.WriteString(" - - [")
+	bb.WriteString(start.Format("02/Jan/2006:15:04:05 -0700"))
+	bb.WriteString("] ")
+	bb.WriteString(quoteField(requestLine(ctx)))
+	bb.WriteByte(' ')
+	bb.WriteString(strconv.Itoa(ctx.Response.StatusCode()))
+	bb.WriteByte(' ')
+	if n := responseBytes(ctx); n > 0 {
+		bb.WriteString(strconv.Itoa(n))
+	} else {
+		bb.WriteByte('-')
+	}
+	if l.format == accessLogCombined || l.format == accessLogExtended {
+		// "referer" "user agent"
+		bb.WriteByte(' ')
+		bb.WriteString(quoteField(ctx.Referer()))
+		bb.WriteByte(' ')
+		bb.WriteString(quoteField(ctx.UserAgent()))
+	}
+	if l.format == accessLogExtended {
+		// latency cache
+		bb.WriteByte(' ')
+		bb.WriteString(strconv.FormatFloat(latency.Seconds(), 'f', 3, 64))
+		bb.WriteByte(' ')
+		if cache == "" {
+			cache = "-"
+		}
+		bb.WriteString(cache)
+	}
+	bb.WriteByte('\n')
+	bb.WriteTo(l.out)
+}
+
+// First line of the request as received
+func requestLine(ctx *fasthttp.RequestCtx) []byte {
+	line := append([]byte(nil), ctx.Method()...)
+	line = append(line, ' ')
+	line = append(line, ctx.RequestURI()...)
+	line = append(line, ' ')
+	return append(line, ctx.Request.Header.Protocol()...)
+}
+
+// Size of the response body sent
+func responseBytes(ctx *fasthttp.RequestCtx) int {
+	if ctx.IsHead() || ctx.Response.StatusCode() == fasthttp.StatusNotModified {
+		return 0
+	}
+	if ctx.Response.IsBodyStream() {
+		return max(ctx.Response.Header.ContentLength(), 0)
+	}
+	return len(ctx.Response.Body())
+}
+
+// Quoted value with quotes and control characters escaped, "-" if empty
+func quoteField(v []byte) string {
+	if len(v) == 0 {
+		return `"-"`
+	}
+	return strconv.Quote(string(v))
+}
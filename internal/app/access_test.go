@@ -0,0 +1,72 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestAccessLog(t *testing.T) {
+	handler := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetUserValue(cacheStatusKey, "hit")
+		ctx.SetStatusCode(fasthttp.StatusOK)
+		ctx.SetBodyString("0123456789")
+	}
+	request := func(l *accessLogger, uri string) {
+		var req fasthttp.Request
+		req.SetRequestURI(uri)
+		req.Header.SetUserAgent(`curl "8"`)
+		var ctx fasthttp.RequestCtx
+		ctx.Init(&req, &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1)}, nil)
+		l.instrument(handler)(&ctx)
+	}
+
+	for _, tc := range []struct {
+		format string
+		uri    string
+		exp    string
+	}{
+		{accessLogCommon, "/dir/?format=html", `^192\.0\.2\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /dir/\?format=html HTTP/1\.1" 200 10\n$`},
+		{accessLogCombined, "/dir/?format=html", `^192\.0\.2\.1 - - \[.+\] "GET /dir/\?format=html HTTP/1\.1" 200 10 "-" "curl \\"8\\""\n$`},
+		{accessLogExtended, "/dir/?format=html", `^192\.0\.2\.1 - - \[.+\] "GET /dir/\?format=html HTTP/1\.1" 200 10 "-" "curl \\"8\\"" \d+\.\d{3} hit\n$`},
+		// Quotes and control characters can't end the field or the line
+		{accessLogCommon, "/a\"b\x1bc", `^192\.0\.2\.1 - - \[.+\] "GET /a\\"b\\x1bc HTTP/1\.1" 200 10\n$`},
+	} {
+		var b bytes.Buffer
+		request(&accessLogger{format: tc.format, out: &b}, tc.uri)
+		if !regexp.MustCompile(tc.exp).Match(b.Bytes()) {
+			t.Errorf("%s: line %q does not match %s", tc.format, b.String(), tc.exp)
+		}
+	}
+
+	var b bytes.Buffer
+	request(&accessLogger{format: accessLogJSON, out: &b}, "/dir/?format=html")
+	var entry accessLogEntry
+	err := json.Unmarshal(b.Bytes(), &entry)
+	if err != nil {
+		t.Fatalf("invalid line %q: %v", b.String(), err)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, entry.Time); err != nil {
+		t.Errorf("invalid time %q", entry.Time)
+	}
+	entry.Time, entry.Latency = "", 0
+	exp := accessLogEntry{
+		ClientIP:  "192.0.2.1",
+		Method:    "GET",
+		Path:      "/dir/",
+		Query:     "format=html",
+		Protocol:  "HTTP/1.1",
+		Status:    200,
+		Bytes:     10,
+		Cache:     "hit",
+		UserAgent: `curl "8"`,
+	}
+	if entry != exp {
+		t.Errorf("entry mismatch:\nexpected %+v\ngot      %+v", exp, entry)
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/HT4w5/autoindex/internal/config"
@@ -15,11 +19,22 @@ import (
 )
 
 type Application struct {
+	// Held for reading while handling requests, for writing while reloading
+	mu  sync.RWMutex
 	cfg config.Config
 
-	index   *index.Index
-	httpsrv *fasthttp.Server
-	logger  log.Logger
+	index     *index.Index
+	httpsrv   *fasthttp.Server
+	metricsrv *fasthttp.Server
+	metrics   *httpMetrics
+	logger    log.Logger
+	logSwitch *log.Switch // Behind logger, replaced on reload
+	logOutput io.Closer
+	accessLog io.Closer
+	template  *template.Template
+	fields    index.Fields // Default extended metadata of listings
+
+	shuttingDown atomic.Bool
 }
 
 func New(cfg config.Config) *Application {
@@ -29,55 +44,56 @@ func New(cfg config.Config) *Application {
 }
 
 func (app *Application) Start() error {
-	var level log.LogLevel
-	switch strings.ToLower(app.cfg.Log.Level) {
-	case "none":
-		level = log.None
-	case "error":
-		level = log.Error
-	case "warn":
-		level = log.Warn
-	case "":
-		fallthrough
-	case "info":
-		level = log.Info
-	case "debug":
-		level = log.Debug
-	}
-	app.logger = &log.SimpleLogger{
-		Level: level,
+	logger, logOutput, err := newLogger(app.cfg.Log)
+	if err != nil {
+		// Nowhere else to report it
+		fmt.Printf("error opening log: %v\n", err)
+		return fmt.Errorf("error opening log: %w", err)
 	}
+	app.logSwitch = log.NewSwitch(logger)
+	app.logger = app.logSwitch
+	app.logOutput = logOutput
 
 	app.logger.Infof("starting application")
 
-	// Create index
-	var err error
-	opts := make([]func(*index.Index), 0)
-	if app.cfg.Filesystem.Root != "" {
-		opts = append(opts, index.WithRoot(app.cfg.Filesystem.Root))
-	}
-	if len(app.cfg.Cache.TTL) != 0 {
-		du, _ := time.ParseDuration(app.cfg.Cache.TTL)
-		opts = append(opts, index.WithTTL(du))
-	}
-	if len(app.cfg.Cache.MaxSize) != 0 {
-		ms, _ := units.FromHumanSize(app.cfg.Cache.MaxSize)
-		if ms >= units.MB {
-			opts = append(opts, index.WithMaxSize(int(ms/units.MB)))
-		}
+	app.index, err = newIndex(app.cfg, app.logger)
+	if err != nil {
+		app.logger.Errorf("error creating index: %v", err)
+		return fmt.Errorf("error creating index: %w", err)
 	}
 
-	opts = append(opts, index.WithLogger(app.logger))
+	app.fields = defaultFields(app.cfg)
 
-	app.index, err = index.New(opts...)
+	app.template, err = loadTemplate(app.cfg.HTTP.Template)
 	if err != nil {
-		app.logger.Errorf("error creating index: %v", err)
-		return fmt.Errorf("error creating index: %w", err)
+		app.logger.Errorf("error loading template: %v", err)
+		return fmt.Errorf("error loading template: %w", err)
 	}
 
 	// HTTP listen
+	handler := app.locked(app.Handle)
+	if app.cfg.Metrics.Enabled {
+		app.metrics = newHTTPMetrics()
+		handler = app.metrics.instrument(handler)
+	}
+	if app.cfg.AccessLog.Enabled {
+		out, err := openLogOutput(app.cfg.AccessLog.OutputConfig)
+		if err != nil {
+			app.logger.Errorf("error opening access log: %v", err)
+			return fmt.Errorf("error opening access log: %w", err)
+		}
+		app.accessLog = out
+		al := &accessLogger{
+			format: app.cfg.AccessLog.Format,
+			out:    out,
+		}
+		if al.format == "" {
+			al.format = accessLogCombined
+		}
+		handler = al.instrument(handler)
+	}
 	app.httpsrv = &fasthttp.Server{
-		Handler:      app.HandleQuery,
+		Handler:      handler,
 		IdleTimeout:  10 * time.Second,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
@@ -96,11 +112,164 @@ func (app *Application) Start() error {
 
 	app.logger.Infof("listening at http://%s:%d", addr, port)
 
+	if app.cfg.Metrics.Enabled {
+		app.startMetrics()
+	}
+
 	return nil
 }
 
+func (app *Application) Logger() log.Logger {
+	return app.logger
+}
+
+// Creates the index described by cfg
+func newIndex(cfg config.Config, logger log.Logger) (*index.Index, error) {
+	opts := make([]func(*index.Index), 0)
+	if cfg.Filesystem.Root != "" {
+		opts = append(opts, index.WithRoot(cfg.Filesystem.Root))
+	}
+	switch strings.ToLower(cfg.Filesystem.Symlinks) {
+	case "list":
+		opts = append(opts, index.WithSymlinks(index.SymlinkList))
+	case "broken":
+		opts = append(opts, index.WithSymlinks(index.SymlinkBroken))
+	case "":
+		fallthrough
+	case "hide":
+		opts = append(opts, index.WithSymlinks(index.SymlinkHide))
+	}
+	if cfg.Filesystem.ShowHidden != nil {
+		opts = append(opts, index.WithHidden(*cfg.Filesystem.ShowHidden))
+	}
+	if len(cfg.Filesystem.Exclude) != 0 {
+		opts = append(opts, index.WithExclude(cfg.Filesystem.Exclude))
+	}
+	if cfg.Filesystem.IgnoreFile != "" {
+		opts = append(opts, index.WithIgnoreFile(cfg.Filesystem.IgnoreFile))
+	}
+	if cfg.Filesystem.MaxDepth != 0 {
+		opts = append(opts, index.WithMaxDepth(int(cfg.Filesystem.MaxDepth)))
+	}
+	if cfg.Filesystem.MaxTreeEntries != 0 {
+		opts = append(opts, index.WithMaxTreeEntries(int(cfg.Filesystem.MaxTreeEntries)))
+	}
+	opts = append(opts, index.WithMIMESniff(cfg.Filesystem.MIMESniff))
+	if cfg.Filesystem.Usage {
+		var u index.Usage
+		if len(cfg.Filesystem.UsageInterval) != 0 {
+			u.Interval, _ = time.ParseDuration(cfg.Filesystem.UsageInterval)
+		}
+		opts = append(opts, index.WithUsage(u))
+	}
+	if cfg.Search.Enabled {
+		s := index.Search{MaxResults: int(cfg.Search.MaxResults)}
+		if len(cfg.Search.Interval) != 0 {
+			s.Interval, _ = time.ParseDuration(cfg.Search.Interval)
+		}
+		opts = append(opts, index.WithSearch(s))
+	}
+	if len(cfg.Cache.TTL) != 0 {
+		du, _ := time.ParseDuration(cfg.Cache.TTL)
+		opts = append(opts, index.WithTTL(du))
+	}
+	ms := int64(10 * units.MB)
+	if len(cfg.Cache.MaxSize) != 0 {
+		ms, _ = units.FromHumanSize(cfg.Cache.MaxSize)
+		if ms >= units.MB {
+			opts = append(opts, index.WithMaxSize(int(ms/units.MB)))
+		}
+	}
+	if len(cfg.Cache.MaxEntrySize) != 0 {
+		es, _ := units.FromHumanSize(cfg.Cache.MaxEntrySize)
+		opts = append(opts, index.WithMaxEntrySize(int(es)))
+	}
+
+	switch strings.ToLower(cfg.Cache.Backend) {
+	case "lru":
+		opts = append(opts, index.WithCache(index.NewLRUCache(int(ms))))
+	case "none":
+		opts = append(opts, index.WithCache(&index.NopCache{}))
+	}
+	if len(cfg.HTTP.Compression.Encodings) != 0 {
+		cc := cfg.HTTP.Compression
+		c := index.Compression{
+			Levels:  make(map[string]int, len(cc.Encodings)),
+			MinSize: units.KB,
+		}
+		for _, encoding := range cc.Encodings {
+			switch encoding {
+			case index.EncodingGzip:
+				c.Levels[encoding] = cc.GzipLevel
+			case index.EncodingBrotli:
+				c.Levels[encoding] = cc.BrotliLevel
+			case index.EncodingZstd:
+				c.Levels[encoding] = cc.ZstdLevel
+			}
+		}
+		if len(cc.MinSize) != 0 {
+			size, _ := units.FromHumanSize(cc.MinSize)
+			c.MinSize = int(size)
+		}
+		opts = append(opts, index.WithCompression(c))
+	}
+	if cfg.Checksum.Enabled {
+		opts = append(opts, index.WithChecksums(index.Checksums{
+			Algorithms: cfg.Checksum.Algorithms,
+			Store:      cfg.Checksum.Store,
+			Workers:    int(cfg.Checksum.Workers),
+		}))
+	}
+	opts = append(opts, index.WithWatch(cfg.Cache.Watch))
+	opts = append(opts, index.WithLogger(logger.With("component", "index")))
+
+	return index.New(opts...)
+}
+
+// Wraps handler to keep the configuration from being reloaded while handling
+// a request
+func (app *Application) locked(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		app.mu.RLock()
+		defer app.mu.RUnlock()
+		handler(ctx)
+	}
+}
+
+func (app *Application) startMetrics() {
+	app.metricsrv = &fasthttp.Server{
+		Handler:      app.locked(app.HandleMetrics),
+		IdleTimeout:  10 * time.Second,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	addr := app.cfg.Metrics.Addr
+	port := app.cfg.Metrics.Port
+	if len(addr) == 0 {
+		addr = "[::]"
+	}
+	if port == 0 {
+		port = 9090
+	}
+
+	go app.metricsrv.ListenAndServe(fmt.Sprintf("%s:%d", addr, port))
+
+	app.logger.Infof("serving metrics at http://%s:%d", addr, port)
+}
+
 func (app *Application) Shutdown() error {
 	app.logger.Infof("shutting down application")
+	app.shuttingDown.Store(true)
+	app.mu.RLock()
+	delay := app.cfg.HTTP.ShutdownDelay
+	app.mu.RUnlock()
+	if len(delay) != 0 {
+		// Let load balancers see readyz fail while still serving
+		du, _ := time.ParseDuration(delay)
+		app.logger.Infof("draining for %s", du)
+		time.Sleep(du)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -113,7 +282,15 @@ func (app *Application) Shutdown() error {
 			app.logger.Errorf("error shutting down: %v", err)
 		}
 	}
+	if app.metricsrv != nil {
+		// Metrics are scraped until the end
+		err = errors.Join(err, app.metricsrv.ShutdownWithContext(ctx))
+	}
 
 	// Index close
-	return errors.Join(err, app.index.Close())
+	err = errors.Join(err, app.index.Close())
+	if app.accessLog != nil {
+		err = errors.Join(err, app.accessLog.Close())
+	}
+	return errors.Join(err, app.logOutput.Close())
 }
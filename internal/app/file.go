@@ -0,0 +1,149 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"path"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const contentTypeOctetStream = "application/octet-stream"
+
+var byteRangeRegexp = regexp.MustCompile(`^bytes=(\d*)-(\d*)$`)
+
+// Response body streaming part of an open file
+type fileStream struct {
+	io.Reader
+	io.Closer
+}
+
+// Streams the contents of the file at path, honoring Range and If-Range.
+// Reports false without writing a response when path is a directory.
+func (app *Application) serveFile(ctx *fasthttp.RequestCtx, path string) bool {
+	f, err := app.index.Open(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			app.logger.Errorf("error opening file %s: %v", path, err)
+		}
+		ctx.SetContentType(contentTypeJSON)
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.SetBody(bodyNotFound)
+		return true
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		app.logger.Errorf("error getting info of file %s: %v", path, err)
+		ctx.SetContentType(contentTypeJSON)
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.SetBody(bodyInternalError)
+		return true
+	}
+	if info.IsDir() {
+		f.Close()
+		return false
+	}
+
+	// Same validator as nginx
+	size := info.Size()
+	mtime := info.ModTime().Unix()
+	etag := fmt.Sprintf(`"%x-%x"`, mtime, size)
+	if notModified(ctx, etag, mtime) {
+		f.Close()
+		return true
+	}
+
+	contentType := mime.TypeByExtension(fileExt(info.Name()))
+	if contentType == "" {
+		contentType = contentTypeOctetStream
+	}
+	ctx.SetContentType(contentType)
+	ctx.Response.Header.Set(fasthttp.HeaderAcceptRanges, "bytes")
+
+	byteRange := ctx.Request.Header.Peek(fasthttp.HeaderRange)
+	if !singleRange(byteRange) || !ifRange(ctx, etag, mtime) {
+		// Multiple or malformed ranges may be ignored, RFC 9110 14.2
+		ctx.SetStatusCode(fasthttp.StatusOK)
+		ctx.SetBodyStream(f, int(size))
+		return true
+	}
+
+	start, end, err := fasthttp.ParseByteRange(byteRange, int(size))
+	if err != nil || start > end {
+		f.Close()
+		app.logger.Debugf("unsatisfiable range %q for %s: %v", byteRange, path, err)
+		ctx.Response.Header.Set(fasthttp.HeaderContentRange, "bytes */"+strconv.FormatInt(size, 10))
+		ctx.SetStatusCode(fasthttp.StatusRequestedRangeNotSatisfiable)
+		return true
+	}
+
+	var r io.Reader
+	if ra, ok := f.(io.ReaderAt); ok {
+		r = io.NewSectionReader(ra, int64(start), int64(end-start+1))
+	} else if s, ok := f.(io.Seeker); ok {
+		_, err = s.Seek(int64(start), io.SeekStart)
+		if err != nil {
+			f.Close()
+			app.logger.Errorf("error seeking file %s: %v", path, err)
+			ctx.SetContentType(contentTypeJSON)
+			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			ctx.SetBody(bodyInternalError)
+			return true
+		}
+		r = io.LimitReader(f, int64(end-start+1))
+	} else {
+		// Ranges need random access, send it whole
+		ctx.SetStatusCode(fasthttp.StatusOK)
+		ctx.SetBodyStream(f, int(size))
+		return true
+	}
+	ctx.Response.Header.SetContentRange(start, end, int(size))
+	ctx.SetStatusCode(fasthttp.StatusPartialContent)
+	ctx.SetBodyStream(fileStream{r, f}, end-start+1)
+	return true
+}
+
+// Reports whether header is a syntactically valid single byte range
+func singleRange(header []byte) bool {
+	m := byteRangeRegexp.FindSubmatch(header)
+	if m == nil || len(m[1])+len(m[2]) == 0 {
+		return false
+	}
+	if len(m[1]) == 0 || len(m[2]) == 0 {
+		return true
+	}
+	first, err := strconv.ParseUint(string(m[1]), 10, 63)
+	if err != nil {
+		return false
+	}
+	last, err := strconv.ParseUint(string(m[2]), 10, 63)
+	return err == nil && first <= last
+}
+
+// Reports whether an If-Range condition, if any, lets a Range apply
+func ifRange(ctx *fasthttp.RequestCtx, etag string, mtime int64) bool {
+	v := ctx.Request.Header.Peek(fasthttp.HeaderIfRange)
+	if len(v) == 0 {
+		return true
+	}
+	if v[0] == '"' {
+		return string(v) == etag
+	}
+	t, err := fasthttp.ParseHTTPDate(v)
+	return err == nil && t.Equal(time.Unix(mtime, 0))
+}
+
+// Extension of name, dotfiles have none
+func fileExt(name string) string {
+	if name != "" && name[0] == '.' {
+		name = name[1:]
+	}
+	return path.Ext(name)
+}
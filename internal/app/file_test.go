@@ -0,0 +1,91 @@
+package app
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/HT4w5/autoindex/internal/config"
+	"github.com/HT4w5/autoindex/pkg/index"
+	"github.com/HT4w5/autoindex/pkg/log"
+	"github.com/valyala/fasthttp"
+)
+
+func TestServeFile(t *testing.T) {
+	mtime := time.Unix(testMTime, 0)
+	fsys := fstest.MapFS{
+		"dir/a.txt":  &fstest.MapFile{Data: []byte("0123456789"), ModTime: mtime},
+		"dir/b.part": &fstest.MapFile{Data: []byte("partial"), ModTime: mtime},
+		"dir/pipe":   &fstest.MapFile{Mode: fs.ModeNamedPipe, ModTime: mtime},
+	}
+	idx, err := index.New(
+		index.WithFS(fsys),
+		index.WithExclude([]string{"*.part"}),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	app := &Application{
+		cfg: config.Config{
+			HTTP: config.HTTPConfig{Download: true, FilesPrefix: "/files/"},
+		},
+		index:  idx,
+		logger: &log.DiscardLogger{},
+	}
+
+	const etag = `"6553f100-a"`
+	tests := []struct {
+		uri    string
+		header map[string]string
+		status int
+		body   string
+		rng    string
+	}{
+		{"/dir/a.txt?download", nil, 200, "0123456789", ""},
+		{"/files/dir/a.txt", nil, 200, "0123456789", ""},
+		{"/files/dir/a.txt", map[string]string{"Range": "bytes=2-4"}, 206, "234", "bytes 2-4/10"},
+		{"/files/dir/a.txt", map[string]string{"Range": "bytes=-3"}, 206, "789", "bytes 7-9/10"},
+		{"/files/dir/a.txt", map[string]string{"Range": "bytes=8-"}, 206, "89", "bytes 8-9/10"},
+		{"/files/dir/a.txt", map[string]string{"Range": "bytes=10-"}, 416, "", "bytes */10"},
+		{"/files/dir/a.txt", map[string]string{"Range": "bytes=0-1,5-6"}, 200, "0123456789", ""},
+		{"/files/dir/a.txt", map[string]string{"Range": "bytes=4-2"}, 200, "0123456789", ""},
+		{"/files/dir/a.txt", map[string]string{"Range": "lines=1-2"}, 200, "0123456789", ""},
+		{"/files/dir/a.txt", map[string]string{"Range": "bytes=2-4", "If-Range": etag}, 206, "234", "bytes 2-4/10"},
+		{"/files/dir/a.txt", map[string]string{"Range": "bytes=2-4", "If-Range": `"0-0"`}, 200, "0123456789", ""},
+		{"/files/dir/a.txt", map[string]string{"Range": "bytes=2-4", "If-Range": "Tue, 14 Nov 2023 22:13:20 GMT"}, 206, "234", "bytes 2-4/10"},
+		{"/files/dir/a.txt", map[string]string{"Range": "bytes=2-4", "If-Range": "Tue, 14 Nov 2023 22:13:21 GMT"}, 200, "0123456789", ""},
+		{"/files/dir/a.txt", map[string]string{"If-None-Match": etag}, 304, "", ""},
+		{"/files/dir/b.part", nil, 404, string(bodyNotFound), ""},
+		{"/files/missing", nil, 404, string(bodyNotFound), ""},
+		{"/files/dir/pipe", nil, 404, string(bodyNotFound), ""},
+		{"/files/dir", nil, 302, "", ""},
+	}
+
+	for _, tt := range tests {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.SetRequestURI(tt.uri)
+		for k, v := range tt.header {
+			ctx.Request.Header.Set(k, v)
+		}
+		app.HandleQuery(&ctx)
+
+		if got := ctx.Response.StatusCode(); got != tt.status {
+			t.Errorf("%s %v: expected status %d, got %d", tt.uri, tt.header, tt.status, got)
+			continue
+		}
+		if got := string(ctx.Response.Body()); tt.status != 302 && got != tt.body {
+			t.Errorf("%s %v: expected body %q, got %q", tt.uri, tt.header, tt.body, got)
+		}
+		if got := string(ctx.Response.Header.Peek("Content-Range")); got != tt.rng {
+			t.Errorf("%s %v: expected Content-Range %q, got %q", tt.uri, tt.header, tt.rng, got)
+		}
+		if tt.status == 200 {
+			if got := string(ctx.Response.Header.ContentType()); got != "text/plain; charset=utf-8" {
+				t.Errorf("%s: unexpected content type %q", tt.uri, got)
+			}
+		}
+	}
+}
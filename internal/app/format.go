@@ -0,0 +1,243 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/HT4w5/autoindex/pkg/index"
+	"github.com/bytedance/sonic"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	formatJSON      = "json"
+	formatNginxJSON = "nginx-json"
+	formatNginxXML  = "nginx-xml"
+	formatNginxHTML = "nginx-html"
+
+	contentTypeXML  = "text/xml"
+	contentTypeHTML = "text/html"
+)
+
+// Renders a directory listing, returning the content type and body
+type renderFunc func(path string, opts index.QueryOptions, resp index.Response) (string, []byte, error)
+
+// Renderer of format, nil for the JSON served by the index. Links in the
+// output keep the query args of the request.
+func (app *Application) renderer(format string, args *fasthttp.Args) (renderFunc, bool) {
+	switch format {
+	case "", formatJSON:
+		return nil, true
+	case formatHTML:
+		query := make(url.Values)
+		for k, v := range args.All() {
+			query.Add(string(k), string(v))
+		}
+		return func(path string, opts index.QueryOptions, resp index.Response) (string, []byte, error) {
+			return app.renderHTML(path, query, opts, resp)
+		}, true
+	case formatNginxJSON:
+		return renderNginxJSON, true
+	case formatNginxXML:
+		return renderNginxXML, true
+	case formatNginxHTML:
+		return renderNginxHTML, true
+	}
+	return app.sumsRenderer(format)
+}
+
+func isNginxFormat(format string) bool {
+	return strings.HasPrefix(format, "nginx-")
+}
+
+func decodeResponse(respBytes []byte) (index.Response, error) {
+	var resp index.Response
+	err := sonic.Unmarshal(respBytes, &resp)
+	return resp, err
+}
+
+// Type names used by nginx, broken symlinks are neither file nor directory
+func nginxType(e index.Entry) string {
+	switch e.Type {
+	case index.TypeDir:
+		return "directory"
+	case index.TypeFile:
+		return "file"
+	}
+	return "other"
+}
+
+// Entries nginx lists, it skips names starting with a dot
+func nginxEntries(entries []index.Entry) []index.Entry {
+	return slices.DeleteFunc(slices.Clone(entries), func(e index.Entry) bool {
+		return strings.HasPrefix(e.Name, ".")
+	})
+}
+
+// Output of ngx_http_autoindex_json
+func renderNginxJSON(_ string, _ index.QueryOptions, resp index.Response) (string, []byte, error) {
+	var b bytes.Buffer
+	b.WriteString("[\r\n")
+	for n, e := range nginxEntries(resp.Contents) {
+		if n > 0 {
+			b.WriteString(",\r\n")
+		}
+		b.WriteString(`{ "name":"`)
+		escapeNginxJSON(&b, e.Name)
+		b.WriteString(`", "type":"`)
+		b.WriteString(nginxType(e))
+		b.WriteString(`", "mtime":"`)
+		b.Write(fasthttp.AppendHTTPDate(nil, time.Unix(e.MTime, 0)))
+		if e.Type == index.TypeFile {
+			fmt.Fprintf(&b, `", "size":%d`, e.Size)
+		} else {
+			b.WriteByte('"')
+		}
+		b.WriteString(" }")
+	}
+	b.WriteString("\r\n]")
+	return contentTypeJSON, b.Bytes(), nil
+}
+
+// Output of ngx_http_autoindex_xml
+func renderNginxXML(_ string, _ index.QueryOptions, resp index.Response) (string, []byte, error) {
+	var b bytes.Buffer
+	b.WriteString("<?xml version=\"1.0\"?>\r\n<list>\r\n")
+	for _, e := range nginxEntries(resp.Contents) {
+		t := nginxType(e)
+		b.WriteByte('<')
+		b.WriteString(t)
+		b.WriteString(time.Unix(e.MTime, 0).UTC().Format(` mtime="2006-01-02T15:04:05Z"`))
+		if e.Type == index.TypeFile {
+			fmt.Fprintf(&b, ` size="%d"`, e.Size)
+		}
+		b.WriteByte('>')
+		escapeNginxHTML(&b, e.Name)
+		b.WriteString("</")
+		b.WriteString(t)
+		b.WriteString(">\r\n")
+	}
+	b.WriteString("</list>\r\n")
+	return contentTypeXML, b.Bytes(), nil
+}
+
+// Width of the name column of nginx's HTML listing
+const nginxNameLen = 50
+
+// Output of ngx_http_autoindex_html with exact sizes and GMT times
+func renderNginxHTML(path string, _ index.QueryOptions, resp index.Response) (string, []byte, error) {
+	var b bytes.Buffer
+	b.WriteString("<html>\r\n<head><title>Index of ")
+	escapeNginxHTML(&b, path)
+	b.WriteString("</title></head>\r\n<body>\r\n<h1>Index of ")
+	escapeNginxHTML(&b, path)
+	b.WriteString("</h1><hr><pre><a href=\"../\">../</a>\r\n")
+
+	for _, e := range nginxEntries(resp.Contents) {
+		isDir := e.Type == index.TypeDir
+
+		b.WriteString(`<a href="`)
+		if strings.IndexByte(e.Name, ':') >= 0 {
+			// Keep the name from being taken for a scheme
+			b.WriteString("./")
+		}
+		escapeNginxURI(&b, e.Name)
+		if isDir {
+			b.WriteByte('/')
+		}
+		b.WriteString(`">`)
+
+		name := e.Name
+		length := utf8.RuneCountInString(name)
+		if length > nginxNameLen {
+			r := []rune(name)
+			escapeNginxHTML(&b, string(r[:nginxNameLen-3]))
+			b.WriteString("..&gt;</a>")
+		} else {
+			escapeNginxHTML(&b, name)
+			if isDir && length < nginxNameLen {
+				b.WriteByte('/')
+				length++
+			}
+			b.WriteString("</a>")
+			b.WriteString(strings.Repeat(" ", nginxNameLen-length))
+		}
+
+		b.WriteByte(' ')
+		b.WriteString(time.Unix(e.MTime, 0).UTC().Format("02-Jan-2006 15:04"))
+		b.WriteByte(' ')
+		if e.Type == index.TypeFile {
+			fmt.Fprintf(&b, "%19d", e.Size)
+		} else {
+			fmt.Fprintf(&b, "%19s", "-")
+		}
+		b.WriteString("\r\n")
+	}
+
+	b.WriteString("</pre><hr></body>\r\n</html>\r\n")
+	return contentTypeHTML, b.Bytes(), nil
+}
+
+// Same as ngx_escape_json
+func escapeNginxJSON(b *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\r':
+			b.WriteString(`\r`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			if c < ' ' {
+				fmt.Fprintf(b, `\u%04X`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+}
+
+// Same as ngx_escape_html
+func escapeNginxHTML(b *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '&':
+			b.WriteString("&amp;")
+		case '"':
+			b.WriteString("&quot;")
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// Same as ngx_escape_uri in NGX_ESCAPE_HTML mode
+func escapeNginxURI(b *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c <= 0x20, c >= 0x7f, strings.IndexByte("\"#%'<>?", c) >= 0:
+			fmt.Fprintf(b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/HT4w5/autoindex/pkg/index"
+	"github.com/HT4w5/autoindex/pkg/log"
+	"github.com/valyala/fasthttp"
+)
+
+const testMTime = 1700000000 // Tue, 14 Nov 2023 22:13:20 GMT
+
+var testListing = index.Response{
+	Type: index.TypeDir,
+	Contents: []index.Entry{
+		{Name: "sub", Type: index.TypeDir, MTime: testMTime},
+		{Name: `a "b".txt`, Type: index.TypeFile, MTime: testMTime, Size: 1234},
+		{Name: "link", Type: index.TypeBroken, MTime: testMTime},
+		{Name: ".hidden", Type: index.TypeFile, MTime: testMTime}, // Skipped by nginx
+	},
+}
+
+func TestRenderNginxJSON(t *testing.T) {
+	exp := "[\r\n" +
+		`{ "name":"sub", "type":"directory", "mtime":"Tue, 14 Nov 2023 22:13:20 GMT" },` + "\r\n" +
+		`{ "name":"a \"b\".txt", "type":"file", "mtime":"Tue, 14 Nov 2023 22:13:20 GMT", "size":1234 },` + "\r\n" +
+		`{ "name":"link", "type":"other", "mtime":"Tue, 14 Nov 2023 22:13:20 GMT" }` + "\r\n" +
+		"]"
+	contentType, body, _ := renderNginxJSON("/dir/", index.QueryOptions{}, testListing)
+	if contentType != contentTypeJSON {
+		t.Errorf("content type mismatch: expected %s, got %s", contentTypeJSON, contentType)
+	}
+	if string(body) != exp {
+		t.Errorf("body mismatch:\nexpected %q\ngot      %q", exp, body)
+	}
+
+	_, body, _ = renderNginxJSON("/dir/", index.QueryOptions{}, index.Response{Type: index.TypeDir})
+	if string(body) != "[\r\n\r\n]" {
+		t.Errorf("empty body mismatch: got %q", body)
+	}
+}
+
+func TestRenderNginxXML(t *testing.T) {
+	exp := "<?xml version=\"1.0\"?>\r\n<list>\r\n" +
+		`<directory mtime="2023-11-14T22:13:20Z">sub</directory>` + "\r\n" +
+		`<file mtime="2023-11-14T22:13:20Z" size="1234">a &quot;b&quot;.txt</file>` + "\r\n" +
+		`<other mtime="2023-11-14T22:13:20Z">link</other>` + "\r\n" +
+		"</list>\r\n"
+	contentType, body, _ := renderNginxXML("/dir/", index.QueryOptions{}, testListing)
+	if contentType != contentTypeXML {
+		t.Errorf("content type mismatch: expected %s, got %s", contentTypeXML, contentType)
+	}
+	if string(body) != exp {
+		t.Errorf("body mismatch:\nexpected %q\ngot      %q", exp, body)
+	}
+}
+
+func TestRenderNginxHTML(t *testing.T) {
+	long := strings.Repeat("x", 60)
+	resp := testListing
+	resp.Contents = append(resp.Contents[:2:2],
+		index.Entry{Name: "a:b", Type: index.TypeFile, MTime: testMTime},
+		index.Entry{Name: long, Type: index.TypeFile, MTime: testMTime, Size: 1},
+		index.Entry{Name: ".hidden", Type: index.TypeDir, MTime: testMTime},
+	)
+
+	exp := "<html>\r\n" +
+		"<head><title>Index of /dir &amp; more/</title></head>\r\n" +
+		"<body>\r\n" +
+		"<h1>Index of /dir &amp; more/</h1><hr><pre><a href=\"../\">../</a>\r\n" +
+		`<a href="sub/">sub/</a>                                               14-Nov-2023 22:13                   -` + "\r\n" +
+		`<a href="a%20%22b%22.txt">a &quot;b&quot;.txt</a>                                          14-Nov-2023 22:13                1234` + "\r\n" +
+		`<a href="./a:b">a:b</a>                                                14-Nov-2023 22:13                   0` + "\r\n" +
+		`<a href="` + long + `">` + long[:47] + `..&gt;</a> 14-Nov-2023 22:13                   1` + "\r\n" +
+		"</pre><hr></body>\r\n</html>\r\n"
+
+	contentType, body, _ := renderNginxHTML("/dir & more/", index.QueryOptions{}, resp)
+	if contentType != contentTypeHTML {
+		t.Errorf("content type mismatch: expected %s, got %s", contentTypeHTML, contentType)
+	}
+	if string(body) != exp {
+		t.Errorf("body mismatch:\nexpected %q\ngot      %q", exp, body)
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	tmpl, err := loadTemplate("")
+	if err != nil {
+		t.Fatalf("error loading template: %v", err)
+	}
+	app := &Application{template: tmpl}
+
+	resp := testListing
+	resp.NextCursor = index.EncodeCursor(3)
+	contentType, body, err := app.renderHTML("/a b/c/", url.Values{
+		"sort":     {"size"},
+		"match":    {"*.txt"},
+		"min_size": {"1k"},
+		"cursor":   {index.EncodeCursor(0)},
+	}, index.QueryOptions{Sort: index.SortSize, Limit: 3}, resp)
+	if err != nil {
+		t.Fatalf("render error: %v", err)
+	}
+	if contentType != contentTypeHTML {
+		t.Errorf("content type mismatch: expected %s, got %s", contentTypeHTML, contentType)
+	}
+
+	for _, exp := range []string{
+		`<a href="/">/</a><a href="/a%20b/">a b/</a><a href="/a%20b/c/">c/</a>`,
+		`<a href="../">../</a>`,
+		`<a href="sub/">sub/</a>`,
+		`<a href="a%20%22b%22.txt">a &#34;b&#34;.txt</a>`,
+		`<td>2023-11-14 22:13:20</td><td class="size">1.234kB</td>`,
+		`<a href="?format=html&amp;match=%2A.txt&amp;min_size=1k&amp;order=desc&amp;sort=size">Size</a> ▲`,
+		`<a href="?format=html&amp;match=%2A.txt&amp;min_size=1k&amp;sort=name">Name</a></th>`,
+		`<a href="?cursor=Mw&amp;format=html&amp;limit=3&amp;match=%2A.txt&amp;min_size=1k&amp;sort=size">Next page</a>`,
+	} {
+		if !strings.Contains(string(body), exp) {
+			t.Errorf("body missing %q", exp)
+		}
+	}
+	// File links point to their contents when served
+	app.cfg.HTTP.Download = true
+	_, body, _ = app.renderHTML("/a b/c/", nil, index.QueryOptions{}, testListing)
+	if exp := `<a href="a%20%22b%22.txt?download">`; !strings.Contains(string(body), exp) {
+		t.Errorf("body missing %q", exp)
+	}
+	app.cfg.HTTP.Download = false
+	app.cfg.HTTP.FilesPrefix = "/files/"
+	_, body, _ = app.renderHTML("/a b/c/", nil, index.QueryOptions{}, testListing)
+	if exp := `<a href="/files/a%20b/c/a%20%22b%22.txt">`; !strings.Contains(string(body), exp) {
+		t.Errorf("body missing %q", exp)
+	}
+
+	// Links of a page opened at an offset can be followed
+	fsys := make(fstest.MapFS)
+	for n := range 8 {
+		fsys[fmt.Sprintf("dir/%d.dat", n)] = &fstest.MapFile{}
+	}
+	app.index, err = index.New(index.WithFS(fsys))
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer app.index.Close()
+	app.logger = &log.DiscardLogger{}
+	get := func(uri string) (int, string) {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.SetRequestURI(uri)
+		app.Handle(&ctx)
+		return ctx.Response.StatusCode(), string(ctx.Response.Body())
+	}
+	status, page := get("/dir/?format=html&offset=2&limit=3")
+	if status != fasthttp.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+	m := regexp.MustCompile(`<a href="(\?[^"]*)">Next page</a>`).FindStringSubmatch(page)
+	if m == nil {
+		t.Fatal("next page link missing")
+	}
+	next := html.UnescapeString(m[1])
+	if strings.Contains(next, "offset") {
+		t.Errorf("next page link %q keeps the offset", next)
+	}
+	if status, _ := get("/dir/" + next); status != fasthttp.StatusOK {
+		t.Errorf("next page link %q: expected status 200, got %d", next, status)
+	}
+}
+
+func TestRenderSums(t *testing.T) {
+	app := &Application{}
+	_, ok := app.renderer("sha256sums", nil)
+	if ok {
+		t.Error("sums format without checksums")
+	}
+
+	app.cfg.Checksum.Enabled = true
+	_, ok = app.renderer("md5sums", nil)
+	if ok {
+		t.Error("sums format of algorithm not computed")
+	}
+	render, ok := app.renderer("sha256sums", nil)
+	if !ok {
+		t.Fatal("sha256sums format missing")
+	}
+
+	sums := func(s string) map[string]string {
+		return map[string]string{index.ChecksumSHA256: s}
+	}
+	resp := index.Response{
+		Type: index.TypeDir,
+		Contents: []index.Entry{
+			{Name: "a.txt", Type: index.TypeFile, Checksums: sums("aa")},
+			{Name: "pending", Type: index.TypeFile},
+			{Name: "sub", Type: index.TypeDir, Children: []index.Entry{
+				{Name: `b\c`, Type: index.TypeFile, Checksums: sums("bb")},
+			}},
+		},
+	}
+	exp := "aa  a.txt\n" + `\bb  sub/b\\c` + "\n"
+	contentType, body, _ := render("/", index.QueryOptions{}, resp)
+	if contentType != contentTypeText {
+		t.Errorf("content type mismatch: expected %s, got %s", contentTypeText, contentType)
+	}
+	if string(body) != exp {
+		t.Errorf("body mismatch:\nexpected %q\ngot      %q", exp, body)
+	}
+}
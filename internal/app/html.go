@@ -0,0 +1,179 @@
+package app
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"maps"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HT4w5/autoindex/pkg/index"
+	"github.com/docker/go-units"
+)
+
+const formatHTML = "html"
+
+//go:embed templates/listing.html
+var templateFS embed.FS
+
+// Loads the listing template from path, or the embedded one if empty
+func loadTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return template.ParseFS(templateFS, "templates/listing.html")
+	}
+	return template.ParseFiles(path)
+}
+
+// Data passed to the listing template
+type htmlPage struct {
+	Path        string
+	Breadcrumbs []htmlLink
+	Columns     []htmlColumn
+	Parent      bool
+	Entries     []htmlEntry
+	Truncated   bool
+	NextHref    string
+}
+
+type htmlLink struct {
+	Name string
+	Href string
+}
+
+type htmlColumn struct {
+	Key   string
+	Name  string
+	Href  string
+	Arrow string
+}
+
+type htmlEntry struct {
+	Name  string
+	Href  string
+	Type  string
+	MTime string
+	Size  string
+}
+
+var htmlColumns = []htmlColumn{
+	{Key: index.SortName, Name: "Name"},
+	{Key: index.SortMTime, Name: "Last modified"},
+	{Key: index.SortSize, Name: "Size"},
+}
+
+// Renders the listing as a page, query holds the args of the request
+func (app *Application) renderHTML(path string, query url.Values, opts index.QueryOptions, resp index.Response) (string, []byte, error) {
+	page := htmlPage{
+		Path:      path,
+		Parent:    path != "/",
+		Truncated: resp.Truncated,
+		Entries:   make([]htmlEntry, 0, len(resp.Contents)),
+	}
+
+	// Breadcrumbs link every parent directory
+	href := "/"
+	page.Breadcrumbs = append(page.Breadcrumbs, htmlLink{Name: "/", Href: href})
+	for elem := range strings.SplitSeq(strings.Trim(path, "/"), "/") {
+		if elem == "" {
+			continue
+		}
+		href += url.PathEscape(elem) + "/"
+		page.Breadcrumbs = append(page.Breadcrumbs, htmlLink{Name: elem + "/", Href: href})
+	}
+
+	// Links keep filters and other args, starting from the first page
+	link := func(set ...string) string {
+		q := maps.Clone(query)
+		if q == nil {
+			q = make(url.Values)
+		}
+		q.Del("cursor")
+		q.Del("offset")
+		q.Del("order")
+		q.Set("format", formatHTML)
+		for n := 0; n+1 < len(set); n += 2 {
+			q.Set(set[n], set[n+1])
+		}
+		return "?" + q.Encode()
+	}
+
+	// Column headers toggle the order of the current sort key
+	sortKey := opts.Sort
+	if sortKey == "" {
+		sortKey = index.SortName
+	}
+	for _, c := range htmlColumns {
+		set := []string{"sort", c.Key}
+		if c.Key == sortKey {
+			c.Arrow = " ▲"
+			if opts.Desc {
+				c.Arrow = " ▼"
+			} else {
+				set = append(set, "order", "desc")
+			}
+		}
+		c.Href = link(set...)
+		page.Columns = append(page.Columns, c)
+	}
+
+	for _, e := range resp.Contents {
+		en := htmlEntry{
+			Name:  e.Name,
+			Href:  url.PathEscape(e.Name),
+			Type:  e.Type,
+			MTime: time.Unix(e.MTime, 0).UTC().Format("2006-01-02 15:04:05"),
+			Size:  "-",
+		}
+		if strings.IndexByte(e.Name, ':') >= 0 {
+			// Keep the name from being taken for a scheme
+			en.Href = "./" + en.Href
+		}
+		switch e.Type {
+		case index.TypeDir:
+			en.Name += "/"
+			en.Href += "/"
+			if e.Files > 0 {
+				en.Size = units.HumanSize(float64(e.Size))
+			}
+		case index.TypeFile:
+			en.Size = units.HumanSize(float64(e.Size))
+			// Link the contents where they are served
+			if app.cfg.HTTP.Download {
+				en.Href += "?download"
+			} else if prefix := strings.TrimSuffix(app.cfg.HTTP.FilesPrefix, "/"); prefix != "" {
+				en.Href = prefix + escapePath(path) + url.PathEscape(e.Name)
+			}
+		}
+		page.Entries = append(page.Entries, en)
+	}
+
+	if resp.NextCursor != "" {
+		set := []string{"cursor", resp.NextCursor, "limit", strconv.Itoa(opts.Limit)}
+		if opts.Desc {
+			set = append(set, "order", "desc")
+		}
+		page.NextHref = link(set...)
+	}
+
+	var b bytes.Buffer
+	err := app.template.Execute(&b, page)
+	if err != nil {
+		return "", nil, fmt.Errorf("error executing template: %w", err)
+	}
+	return contentTypeHTML, b.Bytes(), nil
+}
+
+// Escape every element of the directory path p, with a trailing slash
+func escapePath(p string) string {
+	escaped := "/"
+	for elem := range strings.SplitSeq(strings.Trim(p, "/"), "/") {
+		if elem != "" {
+			escaped += url.PathEscape(elem) + "/"
+		}
+	}
+	return escaped
+}
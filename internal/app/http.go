@@ -1,6 +1,17 @@
 package app
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HT4w5/autoindex/pkg/index"
+	"github.com/docker/go-units"
 	"github.com/valyala/fasthttp"
 )
 
@@ -9,20 +20,396 @@ const (
 )
 
 var (
-	bodyNotFound = []byte(`{"code":404}`)
+	bodyBadRequest    = []byte(`{"code":400}`)
+	bodyNotFound      = []byte(`{"code":404}`)
+	bodyInternalError = []byte(`{"code":500}`)
 )
 
+// Handle routes requests to the endpoints enabled
+func (app *Application) Handle(ctx *fasthttp.RequestCtx) {
+	if rest, ok := strings.CutPrefix(string(ctx.Path()), app.statusPrefix()); ok && app.handleStatus(ctx, rest) {
+		return
+	}
+	if app.cfg.Search.Enabled && string(ctx.Path()) == app.searchPath() {
+		app.HandleSearch(ctx)
+		return
+	}
+	app.HandleQuery(ctx)
+}
+
 func (app *Application) HandleQuery(ctx *fasthttp.RequestCtx) {
 	app.logger.Debugf("incoming request: %s %s", ctx.Method(), ctx.URI().String())
-	resp, ok := app.index.QueryBytes(string(ctx.Path()))
+	path := string(ctx.Path())
+	if prefix := strings.TrimSuffix(app.cfg.HTTP.FilesPrefix, "/"); prefix != "" {
+		if rest, ok := strings.CutPrefix(path, prefix); ok && (rest == "" || rest[0] == '/') {
+			if !app.serveFile(ctx, rest) {
+				// Directories are browsed outside the prefix
+				ctx.Redirect(rest+"/", fasthttp.StatusFound)
+			}
+			return
+		}
+	}
+
+	args := ctx.QueryArgs()
+	if args.Has("download") {
+		if !app.cfg.HTTP.Download {
+			app.badRequest(ctx, errors.New("downloads disabled"))
+			return
+		}
+		if app.serveFile(ctx, path) {
+			return
+		}
+	}
+
+	opts, err := parseQueryOptions(args)
+	if err != nil {
+		app.badRequest(ctx, err)
+		return
+	}
+	if !args.Has("fields") {
+		opts.Fields = app.fields
+	}
+
+	format := app.cfg.HTTP.Format
+	if args.Has("format") {
+		format = string(args.Peek("format"))
+	} else if format == "" || format == formatJSON {
+		ctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderAccept)
+		if acceptsHTML(ctx) {
+			format = formatHTML
+		}
+	}
+	render, ok := app.renderer(format, args)
+	if !ok {
+		app.badRequest(ctx, fmt.Errorf("invalid format %q", format))
+		return
+	}
+	if isNginxFormat(format) && !args.Has("sort") && !args.Has("dirs_first") {
+		// nginx lists directories first
+		opts.DirsFirst = true
+	}
+
+	encoding := app.encoding(ctx)
+	result, ok := app.index.QueryResult(path, opts)
 	if !ok {
 		ctx.SetContentType(contentTypeJSON)
 		ctx.SetStatusCode(fasthttp.StatusNotFound)
 		ctx.SetBody(bodyNotFound)
 		return
 	}
+	if result.Cached {
+		ctx.SetUserValue(cacheStatusKey, "hit")
+	} else {
+		ctx.SetUserValue(cacheStatusKey, "miss")
+	}
 
-	ctx.SetContentType(contentTypeJSON)
+	if render != nil {
+		resp, err := decodeResponse(result.Body)
+		if err != nil {
+			app.logger.Errorf("response unmarshal failed: %v", err)
+			ctx.SetContentType(contentTypeJSON)
+			ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+			ctx.SetBody(bodyInternalError)
+			return
+		}
+		// Files are described in the default format
+		if resp.Type == index.TypeDir {
+			if (isNginxFormat(format) || format == formatHTML) && !strings.HasSuffix(path, "/") {
+				// Relative links need the trailing slash, as in nginx
+				uri := append(ctx.URI().PathOriginal(), '/')
+				if qs := ctx.URI().QueryString(); len(qs) != 0 {
+					uri = append(append(uri, '?'), qs...)
+				}
+				ctx.RedirectBytes(uri, fasthttp.StatusMovedPermanently)
+				return
+			}
+			if notModified(ctx, etag(result, format, encoding), result.MTime) {
+				return
+			}
+			contentType, body, err := render(path, opts, resp)
+			if err != nil {
+				app.logger.Errorf("error rendering %s: %v", format, err)
+				ctx.SetContentType(contentTypeJSON)
+				ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+				ctx.SetBody(bodyInternalError)
+				return
+			}
+			app.send(ctx, contentType, index.Result{Body: body}, encoding)
+			return
+		}
+	}
+
+	if notModified(ctx, etag(result, formatJSON, encoding), result.MTime) {
+		return
+	}
+	app.send(ctx, contentTypeJSON, result, encoding)
+}
+
+// Writes result with status 200, compressed with encoding if worthwhile
+func (app *Application) send(ctx *fasthttp.RequestCtx, contentType string, result index.Result, encoding string) {
+	body := result.Body
+	if encoding != "" {
+		data, ok := app.index.Encoded(result, encoding)
+		if ok {
+			ctx.Response.Header.Set(fasthttp.HeaderContentEncoding, encoding)
+			body = data
+		}
+	}
+	ctx.SetContentType(contentType)
 	ctx.SetStatusCode(fasthttp.StatusOK)
-	ctx.SetBody(resp)
+	ctx.SetBody(body)
+}
+
+// Content coding of the response to ctx, empty for none
+func (app *Application) encoding(ctx *fasthttp.RequestCtx) string {
+	encodings := app.cfg.HTTP.Compression.Encodings
+	if len(encodings) == 0 {
+		return ""
+	}
+	ctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderAcceptEncoding)
+	return negotiateEncoding(ctx.Request.Header.Peek(fasthttp.HeaderAcceptEncoding), encodings)
+}
+
+// Strong validator of result in format and encoding, every representation
+// needs its own tag
+func etag(result index.Result, format string, encoding string) string {
+	tag := result.ETag
+	if format != formatJSON {
+		tag += "-" + format
+	}
+	if encoding != "" {
+		tag += "-" + encoding
+	}
+	return `"` + tag + `"`
+}
+
+// Sets the validators of a response and answers conditional requests
+// matching them with 304
+func notModified(ctx *fasthttp.RequestCtx, etag string, lastModified int64) bool {
+	ctx.Response.Header.Set(fasthttp.HeaderETag, etag)
+	var mtime time.Time
+	if lastModified != 0 {
+		mtime = time.Unix(lastModified, 0)
+		ctx.Response.Header.SetBytesV(fasthttp.HeaderLastModified, fasthttp.AppendHTTPDate(nil, mtime))
+	}
+
+	if !ctx.IsGet() && !ctx.IsHead() {
+		return false
+	}
+	if inm := ctx.Request.Header.Peek(fasthttp.HeaderIfNoneMatch); len(inm) != 0 {
+		// If-Modified-Since is ignored when If-None-Match is present
+		if !etagMatches(inm, etag) {
+			return false
+		}
+	} else {
+		ims, err := fasthttp.ParseHTTPDate(ctx.Request.Header.Peek(fasthttp.HeaderIfModifiedSince))
+		if err != nil || mtime.IsZero() || mtime.After(ims) {
+			return false
+		}
+	}
+	ctx.SetStatusCode(fasthttp.StatusNotModified)
+	return true
+}
+
+// Weak comparison of etag against an If-None-Match list
+func etagMatches(list []byte, etag string) bool {
+	for tag := range bytes.SplitSeq(list, []byte(",")) {
+		tag = bytes.TrimSpace(tag)
+		if string(tag) == "*" || string(bytes.TrimPrefix(tag, []byte("W/"))) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Encoding of encodings, in order of preference, the client accepts with the
+// highest quality. Empty for none.
+func negotiateEncoding(header []byte, encodings []string) string {
+	if len(header) == 0 {
+		return ""
+	}
+	qs := make(map[string]float64)
+	for coding := range bytes.SplitSeq(header, []byte(",")) {
+		name, params, _ := bytes.Cut(coding, []byte(";"))
+		q := 1.0
+		for param := range bytes.SplitSeq(params, []byte(";")) {
+			k, v, _ := bytes.Cut(bytes.TrimSpace(param), []byte("="))
+			if string(k) == "q" {
+				f, err := strconv.ParseFloat(string(v), 64)
+				if err == nil {
+					q = f
+				}
+			}
+		}
+		qs[strings.ToLower(string(bytes.TrimSpace(name)))] = q
+	}
+
+	var best string
+	var bestQ float64
+	for _, encoding := range encodings {
+		q, ok := qs[encoding]
+		if !ok {
+			q = qs["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// Browsers ask for HTML, API clients for anything
+func acceptsHTML(ctx *fasthttp.RequestCtx) bool {
+	return bytes.Contains(ctx.Request.Header.Peek(fasthttp.HeaderAccept), []byte(contentTypeHTML))
+}
+
+func (app *Application) badRequest(ctx *fasthttp.RequestCtx, err error) {
+	app.logger.Debugf("bad request: %v", err)
+	ctx.SetContentType(contentTypeJSON)
+	ctx.SetStatusCode(fasthttp.StatusBadRequest)
+	ctx.SetBody(bodyBadRequest)
+}
+
+func parseQueryOptions(args *fasthttp.Args) (index.QueryOptions, error) {
+	var opts index.QueryOptions
+
+	switch s := string(args.Peek("sort")); s {
+	case "", index.SortName, index.SortMTime, index.SortSize, index.SortType:
+		opts.Sort = s
+	default:
+		return opts, fmt.Errorf("invalid sort %q", s)
+	}
+
+	switch o := string(args.Peek("order")); o {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, fmt.Errorf("invalid order %q", o)
+	}
+
+	if args.Has("dirs_first") {
+		v := args.Peek("dirs_first")
+		opts.DirsFirst = true
+		if len(v) != 0 {
+			b, err := strconv.ParseBool(string(v))
+			if err != nil {
+				return opts, fmt.Errorf("invalid dirs_first %q", v)
+			}
+			opts.DirsFirst = b
+		}
+	}
+
+	filter, err := parseFilter(args)
+	if err != nil {
+		return opts, err
+	}
+	opts.Filter = filter
+
+	if args.Has("limit") {
+		v := string(args.Peek("limit"))
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return opts, fmt.Errorf("invalid limit %q", v)
+		}
+		opts.Limit = limit
+	}
+
+	if args.Has("offset") && args.Has("cursor") {
+		return opts, errors.New("offset and cursor are mutually exclusive")
+	}
+	if args.Has("offset") {
+		v := string(args.Peek("offset"))
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return opts, fmt.Errorf("invalid offset %q", v)
+		}
+		opts.Offset = offset
+	}
+	if args.Has("cursor") {
+		offset, err := index.DecodeCursor(string(args.Peek("cursor")))
+		if err != nil {
+			return opts, err
+		}
+		opts.Offset = offset
+	}
+
+	if args.Has("fields") {
+		fields, err := index.ParseFields(string(args.Peek("fields")))
+		if err != nil {
+			return opts, err
+		}
+		opts.Fields = fields
+	}
+
+	if args.Has("depth") {
+		v := string(args.Peek("depth"))
+		depth, err := strconv.Atoi(v)
+		if err != nil || depth < 0 {
+			return opts, fmt.Errorf("invalid depth %q", v)
+		}
+		opts.Depth = depth
+	}
+
+	return opts, nil
+}
+
+func parseFilter(args *fasthttp.Args) (index.Filter, error) {
+	var f index.Filter
+
+	if args.Has("match") {
+		f.Match = string(args.Peek("match"))
+		_, err := path.Match(f.Match, "")
+		if err != nil {
+			return f, fmt.Errorf("invalid match %q: %w", f.Match, err)
+		}
+	}
+
+	if args.Has("regex") {
+		re, err := regexp.Compile(string(args.Peek("regex")))
+		if err != nil {
+			return f, fmt.Errorf("invalid regex: %w", err)
+		}
+		f.Regexp = re
+	}
+
+	switch t := string(args.Peek("type")); t {
+	case "", index.TypeFile, index.TypeDir, index.TypeBroken, index.TypeSymlink, index.TypeOther:
+		f.Type = t
+	default:
+		return f, fmt.Errorf("invalid type %q", t)
+	}
+
+	if args.Has("min_size") {
+		v := string(args.Peek("min_size"))
+		size, err := units.FromHumanSize(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid min_size %q", v)
+		}
+		f.MinSize = size
+	}
+
+	if args.Has("newer_than") {
+		t, err := parseTime(string(args.Peek("newer_than")))
+		if err != nil {
+			return f, err
+		}
+		f.NewerThan = t
+	}
+
+	return f, nil
+}
+
+// Accepts RFC 3339 timestamps, Unix timestamps and durations relative to now
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(ts, 0), nil
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", v)
 }
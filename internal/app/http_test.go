@@ -0,0 +1,82 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/HT4w5/autoindex/pkg/index"
+	"github.com/valyala/fasthttp"
+)
+
+func TestNotModified(t *testing.T) {
+	result := index.Result{ETag: "1f", MTime: testMTime}
+	tests := []struct {
+		method string
+		header map[string]string
+		format string
+		exp    bool
+	}{
+		{"GET", nil, formatJSON, false},
+		{"GET", map[string]string{"If-None-Match": `"1f"`}, formatJSON, true},
+		{"HEAD", map[string]string{"If-None-Match": `"0", W/"1f"`}, formatJSON, true},
+		{"GET", map[string]string{"If-None-Match": "*"}, formatJSON, true},
+		{"GET", map[string]string{"If-None-Match": `"1f"`}, formatHTML, false},
+		{"GET", map[string]string{"If-None-Match": `"1f-html"`}, formatHTML, true},
+		{"POST", map[string]string{"If-None-Match": `"1f"`}, formatJSON, false},
+		{"GET", map[string]string{"If-Modified-Since": "Tue, 14 Nov 2023 22:13:20 GMT"}, formatJSON, true},
+		{"GET", map[string]string{"If-Modified-Since": "Tue, 14 Nov 2023 22:13:19 GMT"}, formatJSON, false},
+		{"GET", map[string]string{"If-Modified-Since": "not a date"}, formatJSON, false},
+		// If-None-Match takes precedence
+		{"GET", map[string]string{
+			"If-None-Match":     `"0"`,
+			"If-Modified-Since": "Tue, 14 Nov 2023 22:13:20 GMT",
+		}, formatJSON, false},
+	}
+
+	for _, tt := range tests {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.Header.SetMethod(tt.method)
+		for k, v := range tt.header {
+			ctx.Request.Header.Set(k, v)
+		}
+		got := notModified(&ctx, etag(result, tt.format, ""), result.MTime)
+		if got != tt.exp {
+			t.Errorf("%s %v %s: expected %v, got %v", tt.method, tt.header, tt.format, tt.exp, got)
+		}
+		if got && ctx.Response.StatusCode() != fasthttp.StatusNotModified {
+			t.Errorf("%s %v: status %d", tt.method, tt.header, ctx.Response.StatusCode())
+		}
+		if lm := string(ctx.Response.Header.Peek("Last-Modified")); lm != "Tue, 14 Nov 2023 22:13:20 GMT" {
+			t.Errorf("unexpected Last-Modified %q", lm)
+		}
+		if len(ctx.Response.Header.Peek("ETag")) == 0 {
+			t.Error("missing ETag")
+		}
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	encodings := []string{"zstd", "br", "gzip"}
+	tests := []struct {
+		header string
+		exp    string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"gzip, br, zstd", "zstd"},
+		{"GZIP", "gzip"},
+		{"br;q=0.5, gzip;q=0.8", "gzip"},
+		{"br;q=0, gzip", "gzip"},
+		{"*", "zstd"},
+		{"*;q=0.1, gzip", "gzip"},
+		{"zstd;q=0, *", "br"},
+		{"deflate", ""},
+	}
+	for _, tt := range tests {
+		got := negotiateEncoding([]byte(tt.header), encodings)
+		if got != tt.exp {
+			t.Errorf("%q: expected %q, got %q", tt.header, tt.exp, got)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/HT4w5/autoindex/internal/config"
+	"github.com/HT4w5/autoindex/internal/meta"
+	"github.com/HT4w5/autoindex/pkg/log"
+	"github.com/docker/go-units"
+)
+
+func logLevel(level string) log.LogLevel {
+	switch strings.ToLower(level) {
+	case "none":
+		return log.None
+	case "error":
+		return log.Error
+	case "warn":
+		return log.Warn
+	case "debug":
+		return log.Debug
+	default:
+		return log.Info
+	}
+}
+
+// Opens the destination of cfg. Closing stdout and stderr is a no-op.
+func openLogOutput(cfg config.OutputConfig) (io.WriteCloser, error) {
+	switch cfg.Output {
+	case "", "stdout":
+		return nopCloser{os.Stdout}, nil
+	case "stderr":
+		return nopCloser{os.Stderr}, nil
+	case "file":
+		var maxSize int64
+		if len(cfg.MaxSize) != 0 {
+			maxSize, _ = units.FromHumanSize(cfg.MaxSize)
+		}
+		return log.OpenRotatingFile(cfg.File, maxSize, int(cfg.MaxBackups))
+	case "syslog":
+		return log.DialSyslog(cfg.SyslogNetwork, cfg.SyslogAddr, meta.Name)
+	default:
+		return nil, fmt.Errorf("invalid log output %q", cfg.Output)
+	}
+}
+
+// Creates the logger described by cfg along with its output
+func newLogger(cfg config.LogConfig) (log.Logger, io.Closer, error) {
+	out, err := openLogOutput(cfg.OutputConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	level := logLevel(cfg.Level)
+	if cfg.Format == "json" {
+		return log.NewJSONLogger(out, level), out, nil
+	}
+	return &log.SimpleLogger{Level: level, Out: out}, out, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/HT4w5/autoindex/internal/meta"
+	"github.com/HT4w5/autoindex/internal/metrics"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	contentTypeMetrics = "text/plain; version=0.0.4; charset=utf-8"
+	defaultMetricsPath = "/metrics"
+)
+
+type httpMetrics struct {
+	requests *metrics.CounterVec // By status code
+	latency  *metrics.Histogram
+}
+
+func newHTTPMetrics() *httpMetrics {
+	return &httpMetrics{
+		requests: metrics.NewCounterVec(),
+		latency:  metrics.NewHistogram(metrics.DefaultBuckets),
+	}
+}
+
+// Wraps handler to record requests to it
+func (m *httpMetrics) instrument(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		handler(ctx)
+		m.latency.Observe(time.Since(start).Seconds())
+		m.requests.Inc(strconv.Itoa(ctx.Response.StatusCode()))
+	}
+}
+
+// HandleMetrics exports metrics in the Prometheus text format
+func (app *Application) HandleMetrics(ctx *fasthttp.RequestCtx) {
+	path := app.cfg.Metrics.Path
+	if path == "" {
+		path = defaultMetricsPath
+	}
+	if string(ctx.Path()) != path {
+		ctx.SetContentType(contentTypeJSON)
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.SetBody(bodyNotFound)
+		return
+	}
+
+	var b bytes.Buffer
+	w := metrics.NewWriter(&b)
+	w.CounterVec("autoindex_http_requests_total", "HTTP requests by status code.", "code", app.metrics.requests)
+	w.Histogram("autoindex_http_request_duration_seconds", "Latency of HTTP requests.", app.metrics.latency)
+
+	stats := app.index.Stats()
+	w.Counter("autoindex_cache_hits_total", "Cache lookups finding an entry.", stats.Cache.Hits)
+	w.Counter("autoindex_cache_misses_total", "Cache lookups finding no entry.", stats.Cache.Misses)
+	w.Counter("autoindex_cache_expirations_total", "Cached responses found past their TTL.", stats.Expirations)
+	w.Counter("autoindex_cache_evictions_total", "Cache entries dropped to make room or expired.", stats.Cache.Evictions)
+	w.Gauge("autoindex_cache_bytes", "Memory held by the cache.", float64(stats.Cache.Bytes))
+	w.Gauge("autoindex_cache_entries", "Entries in the cache.", float64(stats.Cache.Entries))
+	w.Counter("autoindex_filesystem_read_errors_total", "Failed filesystem reads.", stats.ReadErrors)
+
+	w.Info("autoindex_build_info", "Build information.",
+		"version", meta.Version,
+		"commit", meta.CommitHash,
+		"build_date", meta.BuildDate,
+		"go_version", meta.GoVersion,
+		"platform", meta.Platform,
+	)
+	if err := w.Err(); err != nil {
+		app.logger.Errorf("error writing metrics: %v", err)
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.SetContentType(contentTypeMetrics)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBody(b.Bytes())
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/HT4w5/autoindex/internal/config"
+	"github.com/HT4w5/autoindex/pkg/index"
+)
+
+// Extended metadata of listings without a fields parameter
+func defaultFields(cfg config.Config) index.Fields {
+	fields, _ := index.ParseFields(strings.Join(cfg.HTTP.Fields, ","))
+	return fields
+}
+
+// Settings the index is created from, changing any of them rebuilds it
+func indexSettings(cfg config.Config) any {
+	return []any{cfg.Filesystem, cfg.Cache, cfg.Checksum, cfg.Search, cfg.HTTP.Compression}
+}
+
+// Reload applies cfg to the running application. The log is reopened and
+// the index rebuilt, emptying its cache, if its settings changed. Listeners,
+// metrics and the access log keep their settings until restarted. On error
+// the current configuration stays in effect.
+func (app *Application) Reload(cfg config.Config) error {
+	app.logger.Infof("reloading configuration")
+
+	// Settings only applied on start
+	if cfg.HTTP.Addr != app.cfg.HTTP.Addr || cfg.HTTP.Port != app.cfg.HTTP.Port {
+		app.logger.Warnf("listen address changes apply on restart")
+	}
+	cfg.HTTP.Addr, cfg.HTTP.Port = app.cfg.HTTP.Addr, app.cfg.HTTP.Port
+	if cfg.Metrics != app.cfg.Metrics {
+		app.logger.Warnf("metrics changes apply on restart")
+	}
+	cfg.Metrics = app.cfg.Metrics
+	if cfg.AccessLog != app.cfg.AccessLog {
+		app.logger.Warnf("access log changes apply on restart")
+	}
+	cfg.AccessLog = app.cfg.AccessLog
+
+	logger, logOutput, err := newLogger(cfg.Log)
+	if err != nil {
+		app.logger.Errorf("error opening log: %v", err)
+		return fmt.Errorf("error opening log: %w", err)
+	}
+	tmpl, err := loadTemplate(cfg.HTTP.Template)
+	if err != nil {
+		app.logger.Errorf("error loading template: %v", err)
+		return errors.Join(fmt.Errorf("error loading template: %w", err), logOutput.Close())
+	}
+	var idx *index.Index
+	if !reflect.DeepEqual(indexSettings(cfg), indexSettings(app.cfg)) {
+		idx, err = newIndex(cfg, app.logger)
+		if err != nil {
+			app.logger.Errorf("error creating index: %v", err)
+			return errors.Join(fmt.Errorf("error creating index: %w", err), logOutput.Close())
+		}
+	}
+
+	// Requests in flight finish with the previous configuration
+	app.mu.Lock()
+	app.cfg = cfg
+	app.template = tmpl
+	app.fields = defaultFields(cfg)
+	old := app.index
+	if idx != nil {
+		app.index = idx
+	}
+	app.mu.Unlock()
+
+	app.logSwitch.Set(logger)
+	err = app.logOutput.Close()
+	app.logOutput = logOutput
+	if idx != nil {
+		err = errors.Join(err, old.Close())
+		app.logger.Infof("index rebuilt")
+	}
+	app.logger.Infof("configuration reloaded")
+	return err
+}
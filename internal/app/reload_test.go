@@ -0,0 +1,88 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HT4w5/autoindex/internal/config"
+	"github.com/HT4w5/autoindex/pkg/log"
+)
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Config{
+		Filesystem: config.FileSystemConfig{Root: dir},
+		Cache:      config.CacheConfig{MaxSize: "1MB", TTL: "1m"},
+	}
+	app := New(cfg)
+	app.logSwitch = log.NewSwitch(&log.DiscardLogger{})
+	app.logger = app.logSwitch
+	app.logOutput = nopCloser{os.Stdout}
+	var err error
+	app.index, err = newIndex(cfg, app.logger)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer func() {
+		app.index.Close()
+		app.logOutput.Close()
+	}()
+
+	// Listing settings keep the index
+	idx := app.index
+	logFile := filepath.Join(dir, "autoindex.log")
+	cfg.HTTP.Fields = []string{"mode"}
+	cfg.Log = config.LogConfig{
+		Level:        "info",
+		OutputConfig: config.OutputConfig{Output: "file", File: logFile},
+	}
+	err = app.Reload(cfg)
+	if err != nil {
+		t.Fatalf("reload error: %v", err)
+	}
+	if app.index != idx {
+		t.Error("index rebuilt for unrelated changes")
+	}
+	if app.fields == 0 {
+		t.Error("fields not applied")
+	}
+	data, _ := os.ReadFile(logFile)
+	if !strings.Contains(string(data), "configuration reloaded") {
+		t.Errorf("log not reopened, got %q", data)
+	}
+
+	cfg.Cache.TTL = "2m"
+	err = app.Reload(cfg)
+	if err != nil {
+		t.Fatalf("reload error: %v", err)
+	}
+	if app.index == idx {
+		t.Error("index not rebuilt")
+	}
+
+	// Failed reloads keep the current configuration
+	idx = app.index
+	bad := cfg
+	bad.Cache.TTL = "3m"
+	bad.HTTP.Template = filepath.Join(dir, "missing.html")
+	err = app.Reload(bad)
+	if err == nil {
+		t.Fatal("expected reload error")
+	}
+	if app.index != idx || app.cfg.Cache.TTL != "2m" || app.cfg.HTTP.Template != "" {
+		t.Error("failed reload applied")
+	}
+
+	// Listeners are left alone
+	moved := cfg
+	moved.HTTP.Port = 8081
+	err = app.Reload(moved)
+	if err != nil {
+		t.Fatalf("reload error: %v", err)
+	}
+	if app.cfg.HTTP.Port != 0 {
+		t.Errorf("port changed to %d", app.cfg.HTTP.Port)
+	}
+}
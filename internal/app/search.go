@@ -0,0 +1,72 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/HT4w5/autoindex/pkg/index"
+	"github.com/bytedance/sonic"
+	"github.com/valyala/fasthttp"
+)
+
+const defaultSearchPath = "/search"
+
+func (app *Application) searchPath() string {
+	if app.cfg.Search.Path == "" {
+		return defaultSearchPath
+	}
+	return app.cfg.Search.Path
+}
+
+// HandleSearch finds entries below the root by name, as JSON
+func (app *Application) HandleSearch(ctx *fasthttp.RequestCtx) {
+	app.logger.Debugf("incoming search: %s %s", ctx.Method(), ctx.URI().String())
+
+	opts, err := parseSearchOptions(ctx.QueryArgs())
+	if err != nil {
+		app.badRequest(ctx, err)
+		return
+	}
+	resp, err := app.index.Search(opts)
+	if err != nil {
+		app.badRequest(ctx, err)
+		return
+	}
+	body, err := sonic.Marshal(resp)
+	if err != nil {
+		app.logger.Errorf("search marshal failed: %v", err)
+		ctx.SetContentType(contentTypeJSON)
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.SetBody(bodyInternalError)
+		return
+	}
+	app.send(ctx, contentTypeJSON, index.Result{Body: body}, app.encoding(ctx))
+}
+
+func parseSearchOptions(args *fasthttp.Args) (index.SearchOptions, error) {
+	var opts index.SearchOptions
+
+	opts.Query = string(args.Peek("q"))
+	if opts.Query == "" {
+		return opts, errors.New("empty query")
+	}
+
+	switch m := string(args.Peek("mode")); m {
+	case "", index.SearchSubstring, index.SearchGlob, index.SearchRegexp:
+		opts.Mode = m
+	default:
+		return opts, fmt.Errorf("invalid mode %q", m)
+	}
+
+	if args.Has("limit") {
+		v := string(args.Peek("limit"))
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return opts, fmt.Errorf("invalid limit %q", v)
+		}
+		opts.Limit = limit
+	}
+
+	return opts, nil
+}
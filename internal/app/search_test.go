@@ -0,0 +1,35 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/HT4w5/autoindex/pkg/index"
+	"github.com/valyala/fasthttp"
+)
+
+func TestParseSearchOptions(t *testing.T) {
+	tests := []struct {
+		query string
+		exp   index.SearchOptions
+		ok    bool
+	}{
+		{"q=report", index.SearchOptions{Query: "report"}, true},
+		{"q=*.pdf&mode=glob&limit=10", index.SearchOptions{Query: "*.pdf", Mode: index.SearchGlob, Limit: 10}, true},
+		{"q=%5Ea&mode=regex", index.SearchOptions{Query: "^a", Mode: index.SearchRegexp}, true},
+		{"", index.SearchOptions{}, false},
+		{"q=a&mode=fuzzy", index.SearchOptions{}, false},
+		{"q=a&limit=-1", index.SearchOptions{}, false},
+	}
+	for _, tc := range tests {
+		var args fasthttp.Args
+		args.Parse(tc.query)
+		opts, err := parseSearchOptions(&args)
+		if (err == nil) != tc.ok {
+			t.Errorf("%q: expected ok %v, got error %v", tc.query, tc.ok, err)
+			continue
+		}
+		if tc.ok && opts != tc.exp {
+			t.Errorf("%q: expected %+v, got %+v", tc.query, tc.exp, opts)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"strings"
+
+	"github.com/HT4w5/autoindex/internal/meta"
+	"github.com/bytedance/sonic"
+	"github.com/valyala/fasthttp"
+)
+
+const defaultStatusPrefix = "/.autoindex"
+
+var (
+	bodyOK          = []byte(`{"status":"ok"}`)
+	bodyUnavailable = []byte(`{"code":503}`)
+)
+
+type versionInfo struct {
+	Version    string `json:"version"`
+	CommitHash string `json:"commit_hash"`
+	BuildDate  string `json:"build_date"`
+	Platform   string `json:"platform"`
+	GoVersion  string `json:"go_version"`
+}
+
+// Prefix of the status endpoints, without a trailing slash
+func (app *Application) statusPrefix() string {
+	if app.cfg.HTTP.StatusPrefix == "" {
+		return defaultStatusPrefix
+	}
+	return strings.TrimSuffix(app.cfg.HTTP.StatusPrefix, "/")
+}
+
+// Serves the status endpoint at path below the status prefix, false if there
+// is none
+func (app *Application) handleStatus(ctx *fasthttp.RequestCtx, path string) bool {
+	switch path {
+	case "/healthz":
+		app.HandleHealth(ctx)
+	case "/readyz":
+		app.HandleReady(ctx)
+	case "/version":
+		app.HandleVersion(ctx)
+	default:
+		return false
+	}
+	return true
+}
+
+// HandleHealth answers as long as the process serves requests
+func (app *Application) HandleHealth(ctx *fasthttp.RequestCtx) {
+	ctx.SetContentType(contentTypeJSON)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBody(bodyOK)
+}
+
+// HandleReady answers with 503 while queries would fail or the server is
+// shutting down
+func (app *Application) HandleReady(ctx *fasthttp.RequestCtx) {
+	ctx.SetContentType(contentTypeJSON)
+	if app.shuttingDown.Load() {
+		app.logger.Debugf("not ready: shutting down")
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+		ctx.SetBody(bodyUnavailable)
+		return
+	}
+	if err := app.index.Ready(); err != nil {
+		app.logger.Warnf("not ready: %v", err)
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+		ctx.SetBody(bodyUnavailable)
+		return
+	}
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBody(bodyOK)
+}
+
+// HandleVersion describes the build
+func (app *Application) HandleVersion(ctx *fasthttp.RequestCtx) {
+	body, err := sonic.Marshal(versionInfo{
+		Version:    meta.Version,
+		CommitHash: meta.CommitHash,
+		BuildDate:  meta.BuildDate,
+		Platform:   meta.Platform,
+		GoVersion:  meta.GoVersion,
+	})
+	if err != nil {
+		app.logger.Errorf("version marshal failed: %v", err)
+		ctx.SetContentType(contentTypeJSON)
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		ctx.SetBody(bodyInternalError)
+		return
+	}
+	ctx.SetContentType(contentTypeJSON)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBody(body)
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HT4w5/autoindex/pkg/index"
+	"github.com/HT4w5/autoindex/pkg/log"
+	"github.com/valyala/fasthttp"
+)
+
+func TestStatusEndpoints(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	err := os.Mkdir(root, 0700)
+	if err != nil {
+		t.Fatalf("mkdir error: %v", err)
+	}
+	idx, err := index.New(index.WithRoot(root))
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	app := &Application{
+		index:  idx,
+		logger: &log.DiscardLogger{},
+	}
+	get := func(uri string) (int, string) {
+		var ctx fasthttp.RequestCtx
+		ctx.Request.SetRequestURI(uri)
+		app.Handle(&ctx)
+		return ctx.Response.StatusCode(), string(ctx.Response.Body())
+	}
+
+	for _, uri := range []string{"/.autoindex/healthz", "/.autoindex/readyz"} {
+		if status, _ := get(uri); status != fasthttp.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", uri, status)
+		}
+	}
+	if status, body := get("/.autoindex/version"); status != fasthttp.StatusOK || !strings.Contains(body, `"go_version"`) {
+		t.Errorf("unexpected version response %d %s", status, body)
+	}
+	// Other paths below the prefix are listings
+	if status, _ := get("/.autoindex/other"); status != fasthttp.StatusNotFound {
+		t.Errorf("expected status 404, got %d", status)
+	}
+
+	app.cfg.HTTP.StatusPrefix = "/status/"
+	if status, _ := get("/status/healthz"); status != fasthttp.StatusOK {
+		t.Errorf("prefix with trailing slash: expected status 200, got %d", status)
+	}
+	app.cfg.HTTP.StatusPrefix = "/_status"
+	if status, _ := get("/_status/healthz"); status != fasthttp.StatusOK {
+		t.Errorf("custom prefix: expected status 200, got %d", status)
+	}
+
+	// Permissions don't apply to root
+	if os.Getuid() != 0 {
+		err = os.Chmod(root, 0)
+		if err != nil {
+			t.Fatalf("chmod error: %v", err)
+		}
+		if status, _ := get("/_status/readyz"); status != fasthttp.StatusServiceUnavailable {
+			t.Errorf("unreadable root: expected status 503, got %d", status)
+		}
+		os.Chmod(root, 0700)
+	}
+
+	app.shuttingDown.Store(true)
+	if status, _ := get("/_status/readyz"); status != fasthttp.StatusServiceUnavailable {
+		t.Errorf("shutting down: expected status 503, got %d", status)
+	}
+	if status, _ := get("/_status/healthz"); status != fasthttp.StatusOK {
+		t.Errorf("shutting down: expected healthz status 200, got %d", status)
+	}
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+
+	"github.com/HT4w5/autoindex/pkg/index"
+)
+
+const contentTypeText = "text/plain; charset=utf-8"
+
+// Renderer of a checksum list format named after the algorithm, such as
+// sha256sums, if the algorithm is computed
+func (app *Application) sumsRenderer(format string) (renderFunc, bool) {
+	alg, ok := strings.CutSuffix(format, "sums")
+	if !ok || !app.cfg.Checksum.Enabled {
+		return nil, false
+	}
+	algorithms := app.cfg.Checksum.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{index.ChecksumSHA256}
+	}
+	if !slices.Contains(algorithms, alg) {
+		return nil, false
+	}
+	return func(_ string, _ index.QueryOptions, resp index.Response) (string, []byte, error) {
+		var b bytes.Buffer
+		writeSums(&b, alg, "", resp.Contents)
+		return contentTypeText, b.Bytes(), nil
+	}, true
+}
+
+// Output of sha256sum and friends for the files in entries and their
+// children. Files still being hashed are left out.
+func writeSums(b *bytes.Buffer, alg string, prefix string, entries []index.Entry) {
+	for _, e := range entries {
+		if len(e.Children) != 0 {
+			writeSums(b, alg, prefix+e.Name+"/", e.Children)
+		}
+		sum, ok := e.Checksums[alg]
+		if !ok {
+			continue
+		}
+		name := prefix + e.Name
+		if strings.ContainsAny(name, "\\\n\r") {
+			// Escaped like coreutils does
+			b.WriteByte('\\')
+			name = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`).Replace(name)
+		}
+		b.WriteString(sum)
+		b.WriteString("  ")
+		b.WriteString(name)
+		b.WriteByte('\n')
+	}
+}
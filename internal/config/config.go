@@ -10,28 +10,140 @@ import (
 
 type Config struct {
 	Log        LogConfig        `mapstructure:"log"`
+	AccessLog  AccessLogConfig  `mapstructure:"access_log"`
 	Filesystem FileSystemConfig `mapstructure:"filesystem"`
 	HTTP       HTTPConfig       `mapstructure:"http"`
 	Cache      CacheConfig      `mapstructure:"cache"`
+	Checksum   ChecksumConfig   `mapstructure:"checksum"`
+	Search     SearchConfig     `mapstructure:"search"`
+	Metrics    MetricsConfig    `mapstructure:"metrics"`
+
+	path string // File the configuration was loaded from
 }
 
 type FileSystemConfig struct {
 	Root string `mapstructure:"root" validate:"dirpath"`
+	// Handling of symlinks pointing outside root
+	Symlinks string `mapstructure:"symlinks" validate:"omitempty,oneof=list hide broken"`
+	// List names starting with a dot, true if unset
+	ShowHidden *bool `mapstructure:"show_hidden"`
+	// Glob patterns of names or root relative paths to hide
+	Exclude []string `mapstructure:"exclude" validate:"dive,glob"`
+	// Name of per-directory files listing glob patterns to hide
+	IgnoreFile string `mapstructure:"ignore_file"`
+	// Limits of tree listings
+	MaxDepth       uint `mapstructure:"max_depth"`
+	MaxTreeEntries uint `mapstructure:"max_tree_entries"`
+	// Detect content types of files with unknown extensions from their contents
+	MIMESniff bool `mapstructure:"mime_sniff"`
+	// Aggregate recursive directory sizes in the background
+	Usage bool `mapstructure:"usage"`
+	// Between full rescans of directory sizes
+	UsageInterval string `mapstructure:"usage_interval" validate:"omitempty,duration"`
 }
 
 type HTTPConfig struct {
 	Addr string `mapstructure:"addr" validate:"ip"`
 	Port uint   `mapstructure:"port" validate:"port"`
+	// Default output format of listings
+	Format string `mapstructure:"format" validate:"omitempty,oneof=json html nginx-json nginx-xml nginx-html"`
+	// html/template file replacing the built-in HTML listing
+	Template string `mapstructure:"template" validate:"omitempty,file"`
+	// Extended metadata of listings without a fields parameter
+	Fields []string `mapstructure:"fields" validate:"dive,oneof=mode owner inode type mime all"`
+	// Serve file contents to queries with ?download
+	Download bool `mapstructure:"download"`
+	// Path prefix serving file contents of the paths below it
+	FilesPrefix string `mapstructure:"files_prefix" validate:"omitempty,startswith=/"`
+	// Path prefix of the healthz, readyz and version endpoints
+	StatusPrefix string `mapstructure:"status_prefix" validate:"omitempty,startswith=/"`
+	// How long readyz fails before connections stop being accepted on shutdown
+	ShutdownDelay string `mapstructure:"shutdown_delay" validate:"omitempty,duration"`
+	// Precompressed variants of responses
+	Compression CompressionConfig `mapstructure:"compression"`
+}
+
+type CompressionConfig struct {
+	// Content codings to offer in order of preference
+	Encodings []string `mapstructure:"encodings" validate:"unique,dive,oneof=gzip br zstd"`
+	// Zero selects the default level of each encoding
+	GzipLevel   int `mapstructure:"gzip_level" validate:"min=-2,max=9"`
+	BrotliLevel int `mapstructure:"brotli_level" validate:"min=0,max=11"`
+	ZstdLevel   int `mapstructure:"zstd_level" validate:"min=0,max=22"`
+	// Smaller responses are sent uncompressed
+	MinSize string `mapstructure:"min_size" validate:"omitempty,byte_size"`
 }
 
 type CacheConfig struct {
+	Backend string `mapstructure:"backend" validate:"omitempty,oneof=bigcache lru none"`
 	// Max cache size in bytes
 	MaxSize string `mapstructure:"max_size" validate:"byte_size"`
-	TTL     string `mapstructure:"ttl" validate:"duration"`
+	// Max size of a single cache entry, larger responses are chunked
+	MaxEntrySize string `mapstructure:"max_entry_size" validate:"omitempty,byte_size"`
+	TTL          string `mapstructure:"ttl" validate:"duration"`
+	// Evict cached responses on filesystem changes
+	Watch bool `mapstructure:"watch"`
+}
+
+type ChecksumConfig struct {
+	// Compute checksums of files in the background
+	Enabled bool `mapstructure:"enabled"`
+	// Hash algorithms, sha256 if empty
+	Algorithms []string `mapstructure:"algorithms" validate:"unique,dive,oneof=md5 sha1 sha256 sha512"`
+	// File persisting checksums across restarts
+	Store string `mapstructure:"store"`
+	// Files hashed concurrently
+	Workers uint `mapstructure:"workers"`
+}
+
+type SearchConfig struct {
+	// Serve filename searches from an in-memory index of the whole tree
+	Enabled bool `mapstructure:"enabled"`
+	// Endpoint path, /search if empty
+	Path string `mapstructure:"path" validate:"omitempty,startswith=/"`
+	// Cap of results per search, 1000 if zero
+	MaxResults uint `mapstructure:"max_results"`
+	// Between full crawls of the tree
+	Interval string `mapstructure:"interval" validate:"omitempty,duration"`
+}
+
+type MetricsConfig struct {
+	// Export Prometheus metrics on a listener of their own
+	Enabled bool   `mapstructure:"enabled"`
+	Addr    string `mapstructure:"addr" validate:"omitempty,ip"`
+	Port    uint   `mapstructure:"port" validate:"omitempty,port"`
+	// Endpoint path, /metrics if empty
+	Path string `mapstructure:"path" validate:"omitempty,startswith=/"`
 }
 
 type LogConfig struct {
 	Level string `mapstructure:"level" validate:"oneof=debug warn info error none"`
+	// Plain text lines or a JSON object per line
+	Format       string `mapstructure:"format" validate:"omitempty,oneof=text json"`
+	OutputConfig `mapstructure:",squash"`
+}
+
+type AccessLogConfig struct {
+	// Log every HTTP request regardless of the log level
+	Enabled bool `mapstructure:"enabled"`
+	// Apache common or combined log format, combined with latency and cache
+	// status, or a JSON object per line
+	Format       string `mapstructure:"format" validate:"omitempty,oneof=common combined extended json"`
+	OutputConfig `mapstructure:",squash"`
+}
+
+type OutputConfig struct {
+	// Destination of log lines, stdout if empty
+	Output string `mapstructure:"output" validate:"omitempty,oneof=stdout stderr file syslog"`
+	// Log file of the file output
+	File string `mapstructure:"file" validate:"required_if=Output file"`
+	// Size at which the log file is rotated, never if empty
+	MaxSize string `mapstructure:"max_size" validate:"omitempty,byte_size"`
+	// Rotated log files to keep
+	MaxBackups uint `mapstructure:"max_backups"`
+	// Syslog server of the syslog output, the local one if empty
+	SyslogNetwork string `mapstructure:"syslog_network" validate:"omitempty,oneof=tcp udp unix unixgram"`
+	SyslogAddr    string `mapstructure:"syslog_addr"`
 }
 
 func (cfg *Config) Load() error {
@@ -45,6 +157,7 @@ func (cfg *Config) Load() error {
 		return err
 	}
 
+	cfg.path = vp.ConfigFileUsed()
 	return vp.Unmarshal(cfg)
 }
 
@@ -57,13 +170,20 @@ func (cfg *Config) LoadFromPath(path string) error {
 		return err
 	}
 
+	cfg.path = vp.ConfigFileUsed()
 	return vp.Unmarshal(cfg)
 }
 
+// Path returns the file the configuration was loaded from
+func (cfg *Config) Path() string {
+	return cfg.path
+}
+
 func (cfg *Config) Validate() (validator.ValidationErrors, bool) {
 	validate := validator.New(validator.WithRequiredStructEnabled())
 	validate.RegisterValidation("byte_size", validateByteSize)
 	validate.RegisterValidation("duration", validateDuration)
+	validate.RegisterValidation("glob", validateGlob)
 	err := validate.Struct(cfg)
 	if err != nil {
 		return err.(validator.ValidationErrors), false
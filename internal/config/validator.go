@@ -1,6 +1,7 @@
 package config
 
 import (
+	"path"
 	"time"
 
 	"github.com/docker/go-units"
@@ -18,3 +19,8 @@ func validateDuration(fl validator.FieldLevel) bool {
 	_, err := time.ParseDuration(du)
 	return err == nil
 }
+
+func validateGlob(fl validator.FieldLevel) bool {
+	_, err := path.Match(fl.Field().String(), "")
+	return err == nil
+}
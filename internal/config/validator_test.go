@@ -122,3 +122,47 @@ func TestValidateDuration(t *testing.T) {
 		})
 	}
 }
+
+type globStruct struct {
+	Glob string `validate:"glob"`
+}
+
+func TestValidateGlob(t *testing.T) {
+	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterValidation("glob", validateGlob)
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		// Valid cases
+		{"plain name", "file.dat", false},
+		{"star", "*.iso", false},
+		{"question mark", "file.?", false},
+		{"class", "[a-z]*.txt", false},
+		{"negated class", "[^.]*", false},
+		{"escaped", "\\*.txt", false},
+		{"path", "releases/*/tmp", false},
+		{"empty string", "", false},
+
+		// Invalid cases
+		{"unclosed class", "[a-z", true},
+		{"trailing escape", "file\\", true},
+		{"bad range", "[z-]", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := globStruct{Glob: tt.value}
+			err := validate.Struct(s)
+
+			if tt.wantErr && err == nil {
+				t.Errorf("ValidateGlob(%q) = nil, want error", tt.value)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("ValidateGlob(%q) = %v, want nil", tt.value, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Quiet period after the last event before a change is signaled, editors
+// often write files in several steps
+const watchDelay = 200 * time.Millisecond
+
+// Watcher signals changes of a configuration file
+type Watcher struct {
+	fsw     *fsnotify.Watcher
+	changes chan struct{}
+}
+
+// Watch the file at path. Its directory is watched to follow files being
+// replaced rather than written to.
+func Watch(path string) (*Watcher, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	err = fsw.Add(filepath.Dir(path))
+	if err != nil {
+		fsw.Close()
+		return nil, err
+	}
+	w := &Watcher{
+		fsw:     fsw,
+		changes: make(chan struct{}, 1),
+	}
+	go w.run(path)
+	return w, nil
+}
+
+// Changes receives a value once the file settles after being changed
+func (w *Watcher) Changes() <-chan struct{} {
+	return w.changes
+}
+
+func (w *Watcher) run(path string) {
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				timer.Stop()
+				return
+			}
+			if filepath.Clean(event.Name) != path || event.Op == fsnotify.Chmod {
+				continue
+			}
+			timer.Reset(watchDelay)
+		case _, ok := <-w.fsw.Errors:
+			if !ok {
+				timer.Stop()
+				return
+			}
+		case <-timer.C:
+			select {
+			case w.changes <- struct{}{}:
+			default:
+				// Pending already
+			}
+		}
+	}
+}
+
+func (w *Watcher) Close() error {
+	return w.fsw.Close()
+}
@@ -0,0 +1,165 @@
+// Package metrics implements the few Prometheus metric types the service
+// exports, in the text exposition format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are upper bounds in seconds suiting request latencies
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// CounterVec counts events by the value of a single label
+type CounterVec struct {
+	mu     sync.RWMutex
+	values map[string]*atomic.Int64
+}
+
+func NewCounterVec() *CounterVec {
+	return &CounterVec{
+		values: make(map[string]*atomic.Int64),
+	}
+}
+
+func (c *CounterVec) Inc(label string) {
+	c.mu.RLock()
+	v, ok := c.values[label]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		v, ok = c.values[label]
+		if !ok {
+			v = &atomic.Int64{}
+			c.values[label] = v
+		}
+		c.mu.Unlock()
+	}
+	v.Add(1)
+}
+
+// Counts by label value, in label order
+func (c *CounterVec) snapshot() ([]string, []int64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	labels := make([]string, 0, len(c.values))
+	for l := range c.values {
+		labels = append(labels, l)
+	}
+	slices.Sort(labels)
+	counts := make([]int64, len(labels))
+	for n, l := range labels {
+		counts[n] = c.values[l].Load()
+	}
+	return labels, counts
+}
+
+// Histogram counts observations into buckets
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Int64 // Per bucket, the last one for +Inf
+	sum     atomic.Uint64  // Bits of a float64
+}
+
+func NewHistogram(buckets []float64) *Histogram {
+	return &Histogram{
+		buckets: buckets,
+		counts:  make([]atomic.Int64, len(buckets)+1),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	n, _ := slices.BinarySearch(h.buckets, v)
+	h.counts[n].Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// Writer writes metric families. Errors are sticky and returned by Err.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (w *Writer) printf(format string, a ...any) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, a...)
+}
+
+func (w *Writer) header(name string, help string, typ string) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (w *Writer) Counter(name string, help string, v int64) {
+	w.header(name, help, "counter")
+	w.printf("%s %d\n", name, v)
+}
+
+func (w *Writer) Gauge(name string, help string, v float64) {
+	w.header(name, help, "gauge")
+	w.printf("%s %s\n", name, formatFloat(v))
+}
+
+func (w *Writer) CounterVec(name string, help string, label string, c *CounterVec) {
+	w.header(name, help, "counter")
+	labels, counts := c.snapshot()
+	for n, l := range labels {
+		w.printf("%s{%s=%s} %d\n", name, label, quote(l), counts[n])
+	}
+}
+
+func (w *Writer) Histogram(name string, help string, h *Histogram) {
+	w.header(name, help, "histogram")
+	var total int64
+	for n := range h.counts {
+		total += h.counts[n].Load()
+		le := "+Inf"
+		if n < len(h.buckets) {
+			le = formatFloat(h.buckets[n])
+		}
+		w.printf("%s_bucket{le=%s} %d\n", name, quote(le), total)
+	}
+	w.printf("%s_sum %s\n", name, formatFloat(math.Float64frombits(h.sum.Load())))
+	w.printf("%s_count %d\n", name, total)
+}
+
+// Info writes a gauge of 1 carrying labels, in the given order
+func (w *Writer) Info(name string, help string, labels ...string) {
+	w.header(name, help, "gauge")
+	pairs := make([]string, 0, len(labels)/2)
+	for n := 0; n+1 < len(labels); n += 2 {
+		pairs = append(pairs, labels[n]+"="+quote(labels[n+1]))
+	}
+	w.printf("%s{%s} 1\n", name, strings.Join(pairs, ","))
+}
+
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Label values escape backslashes, quotes and newlines
+func quote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
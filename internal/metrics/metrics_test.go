@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	c := NewCounterVec()
+	c.Inc("200")
+	c.Inc("404")
+	c.Inc("200")
+	h := NewHistogram([]float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(1)
+	h.Observe(2)
+
+	var b strings.Builder
+	w := NewWriter(&b)
+	w.CounterVec("requests_total", "Requests.", "code", c)
+	w.Histogram("latency_seconds", "Latency.", h)
+	w.Counter("hits_total", "Hits.", 3)
+	w.Gauge("bytes", "Bytes.", 1.5)
+	w.Info("build_info", "Build.", "version", `v1 "x"`)
+	if err := w.Err(); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+
+	exp := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{code="200"} 2
+requests_total{code="404"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 3
+latency_seconds_bucket{le="+Inf"} 4
+latency_seconds_sum 3.55
+latency_seconds_count 4
+# HELP hits_total Hits.
+# TYPE hits_total counter
+hits_total 3
+# HELP bytes Bytes.
+# TYPE bytes gauge
+bytes 1.5
+# HELP build_info Build.
+# TYPE build_info gauge
+build_info{version="v1 \"x\""} 1
+`
+	if b.String() != exp {
+		t.Errorf("output mismatch:\nexpected %s\ngot      %s", exp, b.String())
+	}
+}
@@ -0,0 +1,86 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/allegro/bigcache"
+	"github.com/docker/go-units"
+)
+
+// BigCache is the default Cache, backed by allegro/bigcache
+type BigCache struct {
+	cache     *bigcache.BigCache
+	evictions atomic.Int64
+}
+
+// NewBigCache creates a BigCache holding at most maxSize MB with entries of
+// up to maxEntrySize bytes.
+func NewBigCache(maxSize int, maxEntrySize int, ttl time.Duration) (*BigCache, error) {
+	// bigcache rejects entries larger than a shard, so trade shards for
+	// shard capacity until a full entry fits
+	shards := 1024
+	for shards > 1 && maxSize*units.MB/shards <= maxEntrySize {
+		shards /= 2
+	}
+	if maxSize*units.MB/shards <= maxEntrySize {
+		return nil, fmt.Errorf("max entry size %d exceeds cache size", maxEntrySize)
+	}
+
+	c := &BigCache{}
+	var err error
+	c.cache, err = bigcache.NewBigCache(bigcache.Config{
+		Shards:             shards,
+		LifeWindow:         ttl,
+		MaxEntriesInWindow: max(100, maxSize*units.MB/(10*units.KB)),
+		MaxEntrySize:       10 * units.KB,
+		CleanWindow:        time.Minute,
+		HardMaxCacheSize:   maxSize,
+		OnRemoveWithReason: func(key string, entry []byte, reason bigcache.RemoveReason) {
+			if reason != bigcache.Deleted {
+				c.evictions.Add(1)
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *BigCache) Get(key string) ([]byte, error) {
+	value, err := c.cache.Get(key)
+	if errors.Is(err, bigcache.ErrEntryNotFound) {
+		return nil, ErrCacheMiss
+	}
+	return value, err
+}
+
+func (c *BigCache) Set(key string, value []byte) error {
+	return c.cache.Set(key, value)
+}
+
+func (c *BigCache) Delete(key string) error {
+	err := c.cache.Delete(key)
+	if errors.Is(err, bigcache.ErrEntryNotFound) {
+		return ErrCacheMiss
+	}
+	return err
+}
+
+func (c *BigCache) Stats() CacheStats {
+	stats := c.cache.Stats()
+	return CacheStats{
+		Hits:      stats.Hits,
+		Misses:    stats.Misses,
+		Evictions: c.evictions.Load(),
+		Entries:   c.cache.Len(),
+		Bytes:     c.cache.Capacity(),
+	}
+}
+
+func (c *BigCache) Close() error {
+	return c.cache.Close()
+}
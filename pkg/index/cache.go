@@ -0,0 +1,54 @@
+package index
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var ErrCacheMiss = errors.New("cache miss")
+
+// Cache stores marshaled responses for an Index. Implementations must be
+// safe for concurrent use and return ErrCacheMiss for absent keys.
+type Cache interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte) error
+	Delete(key string) error
+	Stats() CacheStats
+	Close() error
+}
+
+type CacheStats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"` // Entries dropped to make room or expired
+	Entries   int   `json:"entries"`
+	Bytes     int   `json:"bytes"` // Memory held by the cache
+}
+
+// NopCache stores nothing, every query reads the filesystem
+type NopCache struct {
+	misses atomic.Int64
+}
+
+func (c *NopCache) Get(key string) ([]byte, error) {
+	c.misses.Add(1)
+	return nil, ErrCacheMiss
+}
+
+func (c *NopCache) Set(key string, value []byte) error {
+	return nil
+}
+
+func (c *NopCache) Delete(key string) error {
+	return nil
+}
+
+func (c *NopCache) Stats() CacheStats {
+	return CacheStats{
+		Misses: c.misses.Load(),
+	}
+}
+
+func (c *NopCache) Close() error {
+	return nil
+}
@@ -0,0 +1,140 @@
+package index_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/HT4w5/autoindex/pkg/index"
+)
+
+func newTestCaches(t *testing.T) map[string]index.Cache {
+	bc, err := index.NewBigCache(10, 10*1024, time.Minute)
+	if err != nil {
+		t.Fatalf("error creating bigcache: %v", err)
+	}
+	return map[string]index.Cache{
+		"bigcache": bc,
+		"lru":      index.NewLRUCache(1024 * 1024),
+	}
+}
+
+func TestCacheBackends(t *testing.T) {
+	for name, c := range newTestCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			defer c.Close()
+
+			_, err := c.Get("missing")
+			if !errors.Is(err, index.ErrCacheMiss) {
+				t.Error(errMsg("get missing error", index.ErrCacheMiss, err))
+			}
+
+			value := []byte("value")
+			err = c.Set("key", value)
+			if err != nil {
+				t.Fatalf("set error: %v", err)
+			}
+			got, err := c.Get("key")
+			if err != nil {
+				t.Fatalf("get error: %v", err)
+			}
+			if !bytes.Equal(got, value) {
+				t.Error(errMsg("value", value, got))
+			}
+
+			err = c.Delete("key")
+			if err != nil {
+				t.Fatalf("delete error: %v", err)
+			}
+			_, err = c.Get("key")
+			if !errors.Is(err, index.ErrCacheMiss) {
+				t.Error(errMsg("get deleted error", index.ErrCacheMiss, err))
+			}
+
+			stats := c.Stats()
+			if stats.Hits != 1 {
+				t.Error(errMsg("hits", 1, stats.Hits))
+			}
+			if stats.Misses != 2 {
+				t.Error(errMsg("misses", 2, stats.Misses))
+			}
+		})
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	c := index.NewLRUCache(30)
+	for n := range 3 {
+		err := c.Set(fmt.Sprint(n), make([]byte, 10))
+		if err != nil {
+			t.Fatalf("set error: %v", err)
+		}
+	}
+
+	// Touch 0 so 1 becomes the least recently used
+	_, err := c.Get("0")
+	if err != nil {
+		t.Fatalf("get error: %v", err)
+	}
+	err = c.Set("3", make([]byte, 10))
+	if err != nil {
+		t.Fatalf("set error: %v", err)
+	}
+
+	for key, exp := range map[string]bool{"0": true, "1": false, "2": true, "3": true} {
+		_, err := c.Get(key)
+		if (err == nil) != exp {
+			t.Error(errMsg("presence of "+key, exp, err == nil))
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Evictions != 1 {
+		t.Error(errMsg("evictions", 1, stats.Evictions))
+	}
+	if stats.Bytes != 30 {
+		t.Error(errMsg("bytes", 30, stats.Bytes))
+	}
+
+	err = c.Set("big", make([]byte, 31))
+	if err == nil {
+		t.Error("expected error for entry bigger than cache")
+	}
+}
+
+func TestQueryNopCache(t *testing.T) {
+	content := map[string]index.Entry{
+		"file.dat": {
+			Name: "file.dat",
+			Size: 1024,
+			Type: index.TypeFile,
+		},
+	}
+
+	dir := t.TempDir()
+	writeContentMap(t, dir, content)
+
+	idx, err := index.New(
+		index.WithRoot(dir),
+		index.WithCache(&index.NopCache{}),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	for range 2 {
+		resp, ok := idx.Query("")
+		if !ok {
+			t.Fatal("index query failed")
+		}
+		if len(resp.Contents) != 1 {
+			t.Error(errMsg("content length", 1, len(resp.Contents)))
+		}
+	}
+	if idx.CacheStats().Misses != 2 {
+		t.Error(errMsg("misses", 2, idx.CacheStats().Misses))
+	}
+}
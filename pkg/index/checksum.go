@@ -0,0 +1,286 @@
+package index
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+// Checksum algorithms
+const (
+	ChecksumMD5    = "md5"
+	ChecksumSHA1   = "sha1"
+	ChecksumSHA256 = "sha256"
+	ChecksumSHA512 = "sha512"
+)
+
+var checksumHashes = map[string]func() hash.Hash{
+	ChecksumMD5:    md5.New,
+	ChecksumSHA1:   sha1.New,
+	ChecksumSHA256: sha256.New,
+	ChecksumSHA512: sha512.New,
+}
+
+// Checksums configures the background computation of file checksums. Files
+// are hashed once they appear in a listing, their checksums are part of
+// listings queried afterwards.
+type Checksums struct {
+	Algorithms []string // Defaults to SHA-256
+	Store      string   // File persisting checksums across restarts, empty keeps them in memory
+	Workers    int      // Files hashed concurrently, defaults to one
+}
+
+// Checksums of a file at the size and mtime it had when hashed
+type checksumRecord struct {
+	Size  int64             `json:"size"`
+	MTime int64             `json:"mtime"` // Unix nanoseconds
+	Sums  map[string]string `json:"sums"`
+}
+
+// Hashes files in the background
+type checksummer struct {
+	index      *Index
+	algorithms []string
+	store      string
+
+	mu      sync.Mutex
+	records map[string]checksumRecord // Root relative name -> checksums
+	pending map[string]struct{}
+	dirty   bool
+
+	queue chan string
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newChecksummer(index *Index, c Checksums) (*checksummer, error) {
+	if len(c.Algorithms) == 0 {
+		c.Algorithms = []string{ChecksumSHA256}
+	}
+	for _, alg := range c.Algorithms {
+		if _, ok := checksumHashes[alg]; !ok {
+			return nil, fmt.Errorf("unknown checksum algorithm %q", alg)
+		}
+	}
+	cs := &checksummer{
+		index:      index,
+		algorithms: c.Algorithms,
+		store:      c.Store,
+		records:    make(map[string]checksumRecord),
+		pending:    make(map[string]struct{}),
+		queue:      make(chan string, 1024),
+		done:       make(chan struct{}),
+	}
+	err := cs.load()
+	if err != nil {
+		return nil, fmt.Errorf("error loading checksums: %w", err)
+	}
+
+	for range max(c.Workers, 1) {
+		cs.wg.Add(1)
+		go cs.work()
+	}
+	if cs.store != "" {
+		cs.wg.Add(1)
+		go cs.persist()
+	}
+	return cs, nil
+}
+
+// Checksums of the file name described by info, nil until computed
+func (cs *checksummer) lookup(name string, info fs.FileInfo) map[string]string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	r, ok := cs.records[name]
+	if ok && r.Size == info.Size() && r.MTime == info.ModTime().UnixNano() {
+		return r.Sums
+	}
+	if _, ok := cs.pending[name]; ok {
+		return nil
+	}
+	select {
+	case cs.queue <- name:
+		cs.pending[name] = struct{}{}
+	default:
+		// Queued again by a later listing
+	}
+	return nil
+}
+
+func (cs *checksummer) work() {
+	defer cs.wg.Done()
+	for {
+		select {
+		case name := <-cs.queue:
+			r, err := cs.compute(name)
+			cs.mu.Lock()
+			delete(cs.pending, name)
+			if err == nil {
+				cs.records[name] = r
+				cs.dirty = true
+			}
+			cs.mu.Unlock()
+			if err != nil {
+				cs.index.logger.Warnf("error computing checksums of %s: %v", name, err)
+				continue
+			}
+			cs.index.logger.Debugf("computed checksums of %s", name)
+			cs.index.invalidate(name)
+		case <-cs.done:
+			return
+		}
+	}
+}
+
+func (cs *checksummer) compute(name string) (checksumRecord, error) {
+	f, err := cs.index.fsys.Open(name)
+	if err != nil {
+		return checksumRecord{}, err
+	}
+	defer f.Close()
+	before, err := f.Stat()
+	if err != nil {
+		return checksumRecord{}, err
+	}
+
+	hashes := make([]hash.Hash, len(cs.algorithms))
+	writers := make([]io.Writer, len(cs.algorithms))
+	for n, alg := range cs.algorithms {
+		hashes[n] = checksumHashes[alg]()
+		writers[n] = hashes[n]
+	}
+	_, err = io.Copy(io.MultiWriter(writers...), f)
+	if err != nil {
+		return checksumRecord{}, err
+	}
+
+	after, err := fs.Stat(cs.index.fsys, name)
+	if err != nil {
+		return checksumRecord{}, err
+	}
+	if after.Size() != before.Size() || !after.ModTime().Equal(before.ModTime()) {
+		return checksumRecord{}, errors.New("file changed while hashing")
+	}
+
+	r := checksumRecord{
+		Size:  before.Size(),
+		MTime: before.ModTime().UnixNano(),
+		Sums:  make(map[string]string, len(hashes)),
+	}
+	for n, h := range hashes {
+		r.Sums[cs.algorithms[n]] = hex.EncodeToString(h.Sum(nil))
+	}
+	return r, nil
+}
+
+func (cs *checksummer) load() error {
+	if cs.store == "" {
+		return nil
+	}
+	data, err := os.ReadFile(cs.store)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return sonic.Unmarshal(data, &cs.records)
+}
+
+// Write the records to the store if they changed
+func (cs *checksummer) save() error {
+	cs.mu.Lock()
+	if !cs.dirty {
+		cs.mu.Unlock()
+		return nil
+	}
+	data, err := sonic.Marshal(cs.records)
+	cs.dirty = false
+	cs.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Replace the store atomically
+	tmp, err := os.CreateTemp(filepath.Dir(cs.store), filepath.Base(cs.store)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	err = errors.Join(err, tmp.Close())
+	if err == nil {
+		err = os.Rename(tmp.Name(), cs.store)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (cs *checksummer) persist() {
+	defer cs.wg.Done()
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := cs.save()
+			if err != nil {
+				cs.index.logger.Errorf("error saving checksums: %v", err)
+			}
+		case <-cs.done:
+			return
+		}
+	}
+}
+
+// Stop hashing and save the checksums computed so far
+func (cs *checksummer) Close() error {
+	close(cs.done)
+	cs.wg.Wait()
+	if cs.store == "" {
+		return nil
+	}
+	return cs.save()
+}
+
+// Checksums of the file name described by info, nil until computed
+func (i *Index) fileChecksums(name string, info fs.FileInfo) map[string]string {
+	if i.checksummer == nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	return i.checksummer.lookup(name, info)
+}
+
+// Drop cached responses showing the file name and the listing containing
+// it. Without a watcher, views of the listing expire with the ttl.
+func (i *Index) invalidate(name string) {
+	dir := path.Dir(name)
+	if i.watcher != nil {
+		i.watcher.evict(filepath.Join(i.root, filepath.FromSlash(name)))
+		i.watcher.evict(filepath.Join(i.root, filepath.FromSlash(dir)))
+		return
+	}
+	i.cache.Delete("/" + name)
+	if dir == "." {
+		i.cache.Delete("")
+	} else {
+		i.cache.Delete("/" + dir)
+	}
+}
@@ -0,0 +1,136 @@
+package index
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings of precompressed responses
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+	EncodingZstd   = "zstd"
+)
+
+// Compression selects the precompressed variants stored with every cached
+// response
+type Compression struct {
+	Levels  map[string]int // Level of every encoding to produce, zero for its default
+	MinSize int            // Responses below this size are not compressed
+}
+
+type encoder func([]byte) ([]byte, error)
+
+func newEncoder(encoding string, level int) (encoder, error) {
+	switch encoding {
+	case EncodingGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			return nil, fmt.Errorf("invalid gzip level %d", level)
+		}
+		return func(data []byte) ([]byte, error) {
+			var b bytes.Buffer
+			w, _ := gzip.NewWriterLevel(&b, level)
+			_, err := w.Write(data)
+			if err != nil {
+				return nil, err
+			}
+			err = w.Close()
+			return b.Bytes(), err
+		}, nil
+	case EncodingBrotli:
+		if level == 0 {
+			level = brotli.DefaultCompression
+		}
+		if level < brotli.BestSpeed || level > brotli.BestCompression {
+			return nil, fmt.Errorf("invalid brotli level %d", level)
+		}
+		return func(data []byte) ([]byte, error) {
+			var b bytes.Buffer
+			w := brotli.NewWriterLevel(&b, level)
+			_, err := w.Write(data)
+			if err != nil {
+				return nil, err
+			}
+			err = w.Close()
+			return b.Bytes(), err
+		}, nil
+	case EncodingZstd:
+		zl := zstd.SpeedDefault
+		if level != 0 {
+			if level < 1 || level > 22 {
+				return nil, fmt.Errorf("invalid zstd level %d", level)
+			}
+			zl = zstd.EncoderLevelFromZstd(level)
+		}
+		// Safe for concurrent EncodeAll calls
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zl))
+		if err != nil {
+			return nil, err
+		}
+		return func(data []byte) ([]byte, error) {
+			return enc.EncodeAll(data, nil), nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q", encoding)
+}
+
+func encodedKey(key string, encoding string) string {
+	return key + "\x00" + encoding
+}
+
+// Store the configured encodings of a response cached under key
+func (i *Index) putEncoded(key string, body []byte, header cacheHeader) {
+	if len(body) < i.compression.MinSize {
+		return
+	}
+	for encoding, enc := range i.encoders {
+		data, err := enc(body)
+		if err != nil {
+			i.logger.Errorf("error compressing \"%s\" with %s: %v", key, encoding, err)
+			continue
+		}
+		err = i.putEntry(encodedKey(key, encoding), data, header)
+		if err != nil {
+			i.logger.Errorf("error saving %s response to cache: %v", encoding, err)
+		}
+	}
+}
+
+// Encoded returns the body of result compressed with encoding, from the
+// cache if it holds the variant. Reports false when the encoding is not
+// configured or the body is too small to be worth it.
+func (i *Index) Encoded(result Result, encoding string) ([]byte, bool) {
+	enc, ok := i.encoders[encoding]
+	if !ok || len(result.Body) < i.compression.MinSize {
+		return nil, false
+	}
+
+	if result.key != "" {
+		key := encodedKey(result.key, encoding)
+		cached, ok := i.queryCache(key)
+		// Variants belong to the response they were stored with
+		if ok && cached.header.Generation == result.header.Generation {
+			return cached.Body, true
+		}
+	}
+
+	data, err := enc(result.Body)
+	if err != nil {
+		i.logger.Errorf("error compressing with %s: %v", encoding, err)
+		return nil, false
+	}
+	if result.key != "" {
+		err = i.putEntry(encodedKey(result.key, encoding), data, result.header)
+		if err != nil {
+			i.logger.Errorf("error saving %s response to cache: %v", encoding, err)
+		}
+	}
+	return data, true
+}
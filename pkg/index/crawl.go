@@ -0,0 +1,224 @@
+package index
+
+import (
+	"io/fs"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Receives the contents of directories found by the crawler
+type crawlObserver interface {
+	// Entries of directory dir, excluding symlinks and excluded entries
+	update(dir string, entries []Entry)
+	// Directory dir and everything below it is gone
+	remove(dir string)
+}
+
+// Keeps observers in sync with the filesystem in the background, by full
+// crawls at an interval and rescans of single directories in between
+type crawler struct {
+	index     *Index
+	interval  time.Duration
+	observers []crawlObserver
+
+	mu      sync.Mutex
+	subdirs map[string]map[string]struct{} // Root relative name -> subdirectory names
+	queued  map[string]struct{}
+	crawled atomic.Bool // Whether a full crawl has finished
+
+	refreshes chan string
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+func newCrawler(index *Index, interval time.Duration, observers []crawlObserver) *crawler {
+	c := &crawler{
+		index:     index,
+		interval:  interval,
+		observers: observers,
+		subdirs:   make(map[string]map[string]struct{}),
+		queued:    make(map[string]struct{}),
+		refreshes: make(chan string, 1024),
+		done:      make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go c.run()
+	return c
+}
+
+// Schedule a rescan of directory name, without descending into the
+// subdirectories already known
+func (c *crawler) touch(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.queued[name]; ok {
+		return
+	}
+	select {
+	case c.refreshes <- name:
+		c.queued[name] = struct{}{}
+	default:
+		// Caught by the next full crawl
+	}
+}
+
+func (c *crawler) run() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	c.crawl()
+	for {
+		select {
+		case name := <-c.refreshes:
+			c.mu.Lock()
+			delete(c.queued, name)
+			c.mu.Unlock()
+			c.scan(name, false)
+		case <-ticker.C:
+			c.crawl()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *crawler) crawl() {
+	start := time.Now()
+	c.scan(".", true)
+	c.crawled.Store(true)
+	c.index.logger.Debugf("crawled root in %v", time.Since(start))
+}
+
+// Read directory name, descending into all subdirectories or only new ones
+func (c *crawler) scan(name string, recursive bool) {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+
+	dirEntries, err := fs.ReadDir(c.index.fsys, name)
+	if err != nil {
+		c.index.logger.Debugf("error scanning %s: %v", name, err)
+		c.remove(name)
+		return
+	}
+
+	var ignored []string
+	if c.index.excludes() {
+		ignored = c.index.ignorePatterns(name)
+	}
+	entries := make([]Entry, 0, len(dirEntries))
+	subdirs := make(map[string]struct{})
+	for _, e := range dirEntries {
+		if c.index.excludes() && c.index.excluded(name, e.Name(), ignored) {
+			continue
+		}
+		// Links are not followed
+		if !e.IsDir() && !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entryFromInfo(info))
+		if e.IsDir() {
+			subdirs[e.Name()] = struct{}{}
+		}
+	}
+
+	c.mu.Lock()
+	var added, removed []string
+	for sub := range subdirs {
+		if _, ok := c.subdirs[name][sub]; recursive || !ok {
+			added = append(added, sub)
+		}
+	}
+	for sub := range c.subdirs[name] {
+		if _, ok := subdirs[sub]; !ok {
+			removed = append(removed, sub)
+		}
+	}
+	c.subdirs[name] = subdirs
+	c.mu.Unlock()
+
+	for _, sub := range removed {
+		c.remove(path.Join(name, sub))
+	}
+	for _, o := range c.observers {
+		o.update(name, entries)
+	}
+	for _, sub := range added {
+		c.scan(path.Join(name, sub), recursive)
+	}
+}
+
+func (c *crawler) remove(name string) {
+	c.mu.Lock()
+	_, ok := c.subdirs[name]
+	c.removeTree(name)
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	for _, o := range c.observers {
+		o.remove(name)
+	}
+}
+
+// Caller must hold c.mu
+func (c *crawler) removeTree(name string) {
+	for sub := range c.subdirs[name] {
+		c.removeTree(path.Join(name, sub))
+	}
+	delete(c.subdirs, name)
+}
+
+func (c *crawler) Close() error {
+	close(c.done)
+	c.wg.Wait()
+	return nil
+}
+
+// Start crawling for the observers configured, at the shortest of their
+// intervals
+func (i *Index) startCrawler() {
+	var observers []crawlObserver
+	var interval time.Duration
+	shortest := func(d time.Duration) {
+		if d > 0 && (interval == 0 || d < interval) {
+			interval = d
+		}
+	}
+	if i.usage != nil {
+		i.aggregator = newAggregator()
+		observers = append(observers, i.aggregator)
+		shortest(i.usage.Interval)
+	}
+	if i.search != nil {
+		if i.search.MaxResults <= 0 {
+			i.search.MaxResults = 1000
+		}
+		i.searcher = newSearchIndex()
+		observers = append(observers, i.searcher)
+		shortest(i.search.Interval)
+	}
+	if len(observers) == 0 {
+		return
+	}
+	if interval == 0 {
+		interval = time.Hour
+	}
+	i.crawler = newCrawler(i, interval, observers)
+}
+
+// Crawled reports whether the first full crawl of the root has finished,
+// which is always the case without usage or search
+func (i *Index) Crawled() bool {
+	return i.crawler == nil || i.crawler.crawled.Load()
+}
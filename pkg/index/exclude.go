@@ -0,0 +1,82 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Whether any rule can exclude entries
+func (i *Index) excludes() bool {
+	return !i.showHidden || len(i.exclude) != 0 || i.ignoreFile != ""
+}
+
+// Patterns of the ignore file in directory dir
+func (i *Index) ignorePatterns(dir string) []string {
+	if i.ignoreFile == "" {
+		return nil
+	}
+	data, err := fs.ReadFile(i.fsys, path.Join(dir, i.ignoreFile))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			i.logger.Warnf("error reading ignore file in %s: %v", dir, err)
+		}
+		return nil
+	}
+
+	var patterns []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// Reports whether the entry name in directory dir is excluded. Configured
+// patterns match the name or its path relative to the root, patterns of the
+// ignore file only the name.
+func (i *Index) excluded(dir string, name string, ignored []string) bool {
+	if !i.showHidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+	if i.ignoreFile != "" && name == i.ignoreFile {
+		return true
+	}
+	rel := path.Join(dir, name)
+	for _, p := range i.exclude {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+	}
+	for _, p := range ignored {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether name or any of its parents is excluded
+func (i *Index) pathExcluded(name string) bool {
+	if name == "." || !i.excludes() {
+		return false
+	}
+	dir := "."
+	for elem := range strings.SplitSeq(name, "/") {
+		if i.excluded(dir, elem, i.ignorePatterns(dir)) {
+			return true
+		}
+		dir = path.Join(dir, elem)
+	}
+	return false
+}
@@ -0,0 +1,25 @@
+package index
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// Open opens the file or directory at path to read its contents. Paths are
+// resolved in the sandbox and subject to the exclusion rules like queries
+// are. Pipes, sockets and devices don't exist to Open.
+func (i *Index) Open(path string) (fs.File, error) {
+	name := rootName(path)
+	if strings.IndexByte(name, 0) >= 0 || i.targetExcluded(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	// Opening a pipe blocks until it has a writer
+	info, err := fs.Stat(i.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return i.fsys.Open(name)
+}
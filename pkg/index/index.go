@@ -1,46 +1,128 @@
 package index
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sync/atomic"
 	"time"
 
 	"github.com/HT4w5/autoindex/pkg/log"
-	"github.com/allegro/bigcache"
 	"github.com/docker/go-units"
 )
 
 type Index struct {
-	cache  *bigcache.BigCache
-	logger log.Logger
+	cache   Cache
+	fsys    fs.FS
+	fsroot  *os.Root // Set when fsys is the OS filesystem under root
+	logger  log.Logger
+	watcher *watcher
+
+	checksummer *checksummer
+	crawler     *crawler
+	aggregator  *aggregator
+	searcher    *searchIndex
+
+	// Chunked entries of a single write share a generation
+	generation atomic.Uint64
+
+	expirations atomic.Int64
+	readErrors  atomic.Int64
+
+	owners ownerNames
 
 	// Config
-	root    string
-	ttl     time.Duration
-	maxSize int
+	root           string
+	ttl            time.Duration
+	maxSize        int
+	maxEntrySize   int
+	watch          bool
+	symlinks       SymlinkPolicy
+	showHidden     bool
+	exclude        []string
+	ignoreFile     string
+	maxDepth       int
+	maxTreeEntries int
+	compression    Compression
+	mimeSniff      bool
+	checksums      *Checksums
+	usage          *Usage
+	search         *Search
+
+	encoders map[string]encoder
 }
 
 func New(opts ...func(*Index)) (*Index, error) {
 	index := &Index{
-		root:    ".",
-		ttl:     time.Minute,
-		maxSize: 10,
-		logger:  &log.DiscardLogger{},
+		root:           ".",
+		ttl:            time.Minute,
+		maxSize:        10,
+		maxEntrySize:   10 * units.KB,
+		showHidden:     true,
+		maxDepth:       8,
+		maxTreeEntries: 10000,
+		logger:         &log.DiscardLogger{},
 	}
 	for _, o := range opts {
 		o(index)
 	}
+	if index.maxEntrySize <= entryOverhead+cacheHeaderSize {
+		return nil, fmt.Errorf("max entry size %d too small", index.maxEntrySize)
+	}
+
+	for _, p := range index.exclude {
+		_, err := path.Match(p, "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", p, err)
+		}
+	}
+
+	index.encoders = make(map[string]encoder, len(index.compression.Levels))
+	for encoding, level := range index.compression.Levels {
+		enc, err := newEncoder(encoding, level)
+		if err != nil {
+			return nil, fmt.Errorf("error creating encoder: %w", err)
+		}
+		index.encoders[encoding] = enc
+	}
+
 	var err error
-	index.cache, err = bigcache.NewBigCache(bigcache.Config{
-		Shards:             1024,
-		LifeWindow:         index.ttl,
-		MaxEntriesInWindow: max(100, index.maxSize*units.MB/(10*units.KB)),
-		MaxEntrySize:       10 * units.KB,
-		CleanWindow:        time.Minute,
-		HardMaxCacheSize:   index.maxSize,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("error creating bigcache: %w", err)
+	if index.fsys == nil {
+		index.fsroot, err = os.OpenRoot(index.root)
+		if err != nil {
+			return nil, fmt.Errorf("error opening root: %w", err)
+		}
+		index.fsys = index.fsroot.FS()
+	} else if index.watch {
+		return nil, errors.New("watching requires the OS filesystem")
 	}
+
+	if index.cache == nil {
+		index.cache, err = NewBigCache(index.maxSize, index.maxEntrySize, index.ttl)
+		if err != nil {
+			index.closeRoot()
+			return nil, fmt.Errorf("error creating bigcache: %w", err)
+		}
+	}
+	if index.watch {
+		index.watcher, err = newWatcher(index)
+		if err != nil {
+			index.cache.Close()
+			index.closeRoot()
+			return nil, fmt.Errorf("error creating watcher: %w", err)
+		}
+	}
+	if index.checksums != nil {
+		index.checksummer, err = newChecksummer(index, *index.checksums)
+		if err != nil {
+			index.Close()
+			return nil, fmt.Errorf("error creating checksummer: %w", err)
+		}
+	}
+	index.startCrawler()
 	return index, nil
 }
 
@@ -50,6 +132,13 @@ func WithRoot(root string) func(*Index) {
 	}
 }
 
+// WithFS serves fsys instead of the OS filesystem under the root
+func WithFS(fsys fs.FS) func(*Index) {
+	return func(i *Index) {
+		i.fsys = fsys
+	}
+}
+
 func WithTTL(ttl time.Duration) func(*Index) {
 	return func(i *Index) {
 		i.ttl = ttl
@@ -62,6 +151,109 @@ func WithMaxSize(size int) func(*Index) {
 	}
 }
 
+// WithMaxEntrySize sets the size in bytes of a single cache entry.
+// Responses exceeding it are split across multiple entries.
+func WithMaxEntrySize(size int) func(*Index) {
+	return func(i *Index) {
+		i.maxEntrySize = size
+	}
+}
+
+// WithWatch enables evicting cached responses on filesystem changes
+func WithWatch(watch bool) func(*Index) {
+	return func(i *Index) {
+		i.watch = watch
+	}
+}
+
+// WithSymlinks sets how symlinks escaping the root are listed
+func WithSymlinks(policy SymlinkPolicy) func(*Index) {
+	return func(i *Index) {
+		i.symlinks = policy
+	}
+}
+
+// WithCache replaces the default BigCache. The index takes ownership of
+// cache and closes it along with itself.
+func WithCache(cache Cache) func(*Index) {
+	return func(i *Index) {
+		i.cache = cache
+	}
+}
+
+// WithHidden sets whether names starting with a dot are listed
+func WithHidden(show bool) func(*Index) {
+	return func(i *Index) {
+		i.showHidden = show
+	}
+}
+
+// WithExclude hides entries whose name or path relative to the root matches
+// any of the glob patterns
+func WithExclude(patterns []string) func(*Index) {
+	return func(i *Index) {
+		i.exclude = patterns
+	}
+}
+
+// WithIgnoreFile hides entries matching the glob patterns listed in a file
+// called name in their directory, one per line
+func WithIgnoreFile(name string) func(*Index) {
+	return func(i *Index) {
+		i.ignoreFile = name
+	}
+}
+
+// WithMaxDepth caps the depth of tree listings
+func WithMaxDepth(depth int) func(*Index) {
+	return func(i *Index) {
+		i.maxDepth = depth
+	}
+}
+
+// WithMaxTreeEntries caps the total number of entries in a tree listing
+func WithMaxTreeEntries(n int) func(*Index) {
+	return func(i *Index) {
+		i.maxTreeEntries = n
+	}
+}
+
+// WithMIMESniff detects the content type of files with unknown extensions
+// from their contents
+func WithMIMESniff(sniff bool) func(*Index) {
+	return func(i *Index) {
+		i.mimeSniff = sniff
+	}
+}
+
+// WithCompression stores compressed variants of cached responses
+func WithCompression(c Compression) func(*Index) {
+	return func(i *Index) {
+		i.compression = c
+	}
+}
+
+// WithChecksums computes checksums of files in the background
+func WithChecksums(c Checksums) func(*Index) {
+	return func(i *Index) {
+		i.checksums = &c
+	}
+}
+
+// WithUsage aggregates the recursive size of directories in the background
+func WithUsage(u Usage) func(*Index) {
+	return func(i *Index) {
+		i.usage = &u
+	}
+}
+
+// WithSearch keeps an in-memory index of all names for Search
+func WithSearch(s Search) func(*Index) {
+	return func(i *Index) {
+		i.search = &s
+	}
+}
+
 func WithLogger(logger log.Logger) func(*Index) {
 	return func(i *Index) {
 		i.logger = logger
@@ -69,5 +261,57 @@ func WithLogger(logger log.Logger) func(*Index) {
 }
 
 func (i *Index) Close() error {
-	return i.cache.Close()
+	var errs []error
+	if i.crawler != nil {
+		errs = append(errs, i.crawler.Close())
+	}
+	if i.checksummer != nil {
+		errs = append(errs, i.checksummer.Close())
+	}
+	if i.watcher != nil {
+		errs = append(errs, i.watcher.Close())
+	}
+	return errors.Join(append(errs, i.cache.Close(), i.closeRoot())...)
+}
+
+// Ready returns why queries would fail, nil if the root can be read
+func (i *Index) Ready() error {
+	f, err := i.fsys.Open(".")
+	if err != nil {
+		return fmt.Errorf("error opening root: %w", err)
+	}
+	defer f.Close()
+	if d, ok := f.(fs.ReadDirFile); ok {
+		_, err = d.ReadDir(1)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("error reading root: %w", err)
+		}
+	}
+	return nil
+}
+
+func (i *Index) closeRoot() error {
+	if i.fsroot == nil {
+		return nil
+	}
+	return i.fsroot.Close()
+}
+
+func (i *Index) CacheStats() CacheStats {
+	return i.cache.Stats()
+}
+
+// Stats of an Index since its creation
+type Stats struct {
+	Cache       CacheStats
+	Expirations int64 // Cached responses found past their TTL
+	ReadErrors  int64 // Failed filesystem reads, missing paths aside
+}
+
+func (i *Index) Stats() Stats {
+	return Stats{
+		Cache:       i.cache.Stats(),
+		Expirations: i.expirations.Load(),
+		ReadErrors:  i.readErrors.Load(),
+	}
 }
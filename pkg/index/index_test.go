@@ -2,16 +2,29 @@ package index_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"maps"
 	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/HT4w5/autoindex/pkg/index"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
 const (
@@ -301,3 +314,1363 @@ func TestCacheExpiry(t *testing.T) {
 		)
 	}
 }
+
+func TestQueryChunked(t *testing.T) {
+	for _, entrySize := range []int{512, 10 * 1024, 64 * 1024} {
+		t.Run(fmt.Sprintf("TestQueryChunked_%d", entrySize), func(t *testing.T) {
+			var seed [32]byte
+			binary.BigEndian.PutUint64(seed[:], uint64(entrySize))
+			r := rand.New(rand.NewChaCha8(seed))
+
+			content := make(map[string]index.Entry)
+			for range 2000 {
+				e := makeEntry(r)
+				content[e.Name] = e
+			}
+			dir := t.TempDir()
+			writeContentMap(t, dir, content)
+
+			idx, err := index.New(
+				index.WithRoot(dir),
+				index.WithTTL(time.Hour),
+				index.WithMaxEntrySize(entrySize),
+			)
+			if err != nil {
+				t.Fatalf("error creating index: %v", err)
+			}
+			defer idx.Close()
+
+			respGot, ok := idx.Query("")
+			if !ok {
+				t.Fatal("index query failed")
+			}
+			if len(respGot.Contents) != len(content) {
+				t.Fatal(errMsg("content length", len(content), len(respGot.Contents)))
+			}
+
+			// Served from cache, the removal must not be visible
+			err = os.RemoveAll(filepath.Join(dir, respGot.Contents[0].Name))
+			if err != nil {
+				t.Fatalf("remove error: %v", err)
+			}
+
+			respGot, ok = idx.Query("")
+			if !ok {
+				t.Fatal("index query failed")
+			}
+			if len(respGot.Contents) != len(content) {
+				t.Error(errMsg("cached content length", len(content), len(respGot.Contents)))
+			}
+			for _, got := range respGot.Contents {
+				exp, ok := content[got.Name]
+				if !ok {
+					t.Errorf("unexpected entry %s", got.Name)
+					continue
+				}
+				entryEq(t, exp, got)
+			}
+		})
+	}
+}
+
+func TestQueryLongKey(t *testing.T) {
+	dir := t.TempDir()
+	long := strings.Repeat("x", 150)
+	err := os.MkdirAll(filepath.Join(dir, long, "sub"), 0700)
+	if err != nil {
+		t.Fatalf("mkdir error: %v", err)
+	}
+
+	idx, err := index.New(
+		index.WithRoot(dir),
+		index.WithMaxEntrySize(200),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	// Keys too long to cache are served uncached
+	for range 2 {
+		resp, ok := idx.Query("/" + long)
+		if !ok {
+			t.Fatal("index query failed")
+		}
+		if len(resp.Contents) != 1 || resp.Contents[0].Name != "sub" {
+			t.Errorf("unexpected contents %+v", resp.Contents)
+		}
+		_, ok = idx.QueryResult("/"+long, index.QueryOptions{Desc: true})
+		if !ok {
+			t.Fatal("index view query failed")
+		}
+	}
+}
+
+func TestMaxEntrySizeTooSmall(t *testing.T) {
+	_, err := index.New(
+		index.WithRoot(t.TempDir()),
+		index.WithMaxEntrySize(16),
+	)
+	if err == nil {
+		t.Error("expected error for tiny max entry size")
+	}
+}
+
+// Poll until the listing of path contains name
+func waitForEntry(t *testing.T, idx *index.Index, path string, name string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, ok := idx.Query(path)
+		if ok {
+			for _, e := range resp.Contents {
+				if e.Name == name {
+					return
+				}
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Errorf("entry %s not visible in %q", name, path)
+}
+
+func TestWatchInvalidation(t *testing.T) {
+	content := map[string]index.Entry{
+		"sub": {
+			Name: "sub",
+			Type: index.TypeDir,
+		},
+	}
+
+	dir := t.TempDir()
+	writeContentMap(t, dir, content)
+	err := os.Chmod(filepath.Join(dir, "sub"), 0700)
+	if err != nil {
+		t.Fatalf("chmod error: %v", err)
+	}
+
+	idx, err := index.New(
+		index.WithRoot(dir),
+		index.WithTTL(time.Hour),
+		index.WithWatch(true),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	_, ok := idx.Query("")
+	if !ok {
+		t.Fatal("index query failed")
+	}
+	_, ok = idx.Query("/sub")
+	if !ok {
+		t.Fatal("index query failed")
+	}
+
+	// New entry in a cached directory
+	err = os.WriteFile(filepath.Join(dir, "new.dat"), nil, 0600)
+	if err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	waitForEntry(t, idx, "", "new.dat")
+
+	// New entry in a subdirectory
+	err = os.WriteFile(filepath.Join(dir, "sub", "nested.dat"), nil, 0600)
+	if err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	waitForEntry(t, idx, "/sub", "nested.dat")
+}
+
+// Create root with symlinks into and out of it next to a secret file
+func makeSandboxDir(t *testing.T) string {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "root")
+	for _, d := range []string{root, filepath.Join(parent, "secretdir")} {
+		err := os.Mkdir(d, 0700)
+		if err != nil {
+			t.Fatalf("mkdir error: %v", err)
+		}
+	}
+	files := map[string]int{
+		filepath.Join(parent, "secret.dat"):              64,
+		filepath.Join(parent, "secretdir", "secret.dat"): 64,
+		filepath.Join(root, "inside.dat"):                32,
+	}
+	for name, size := range files {
+		err := os.WriteFile(name, make([]byte, size), 0600)
+		if err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+	}
+	links := map[string]string{
+		"in":       "inside.dat",
+		"out":      "../secret.dat",
+		"outdir":   filepath.Join(parent, "secretdir"),
+		"dangling": "missing.dat",
+	}
+	for name, target := range links {
+		err := os.Symlink(target, filepath.Join(root, name))
+		if err != nil {
+			t.Fatalf("symlink error: %v", err)
+		}
+	}
+	return root
+}
+
+func TestQueryTraversal(t *testing.T) {
+	root := makeSandboxDir(t)
+	idx, err := index.New(
+		index.WithRoot(root),
+		index.WithSymlinks(index.SymlinkList),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	for _, path := range []string{
+		"/../secret.dat",
+		"../secret.dat",
+		"/%2e%2e/secret.dat",
+		"/out",
+		"/outdir",
+		"/outdir/secret.dat",
+		"/dangling",
+	} {
+		_, ok := idx.Query(path)
+		if ok {
+			t.Errorf("query %q escaped root", path)
+		}
+	}
+
+	// Climbing above the root stops at the root
+	resp, ok := idx.Query("/../..")
+	if !ok {
+		t.Fatal("index query failed")
+	}
+	for _, e := range resp.Contents {
+		if e.Name == "root" || e.Name == "secret.dat" {
+			t.Errorf("listing of %q escaped root", "/../..")
+		}
+	}
+
+	resp, ok = idx.Query("/in")
+	if !ok {
+		t.Fatal("index query failed")
+	}
+	if resp.Type != index.TypeFile || resp.Size != 32 {
+		t.Errorf("unexpected response for symlink inside root: %+v", resp)
+	}
+}
+
+func TestSymlinkPolicy(t *testing.T) {
+	tests := []struct {
+		policy index.SymlinkPolicy
+		exp    map[string]index.Entry // Expected symlink entries
+	}{
+		{index.SymlinkHide, map[string]index.Entry{
+			"in": {Type: index.TypeFile, Size: 32},
+		}},
+		{index.SymlinkList, map[string]index.Entry{
+			"in":       {Type: index.TypeFile, Size: 32},
+			"out":      {Type: index.TypeFile, Size: 64},
+			"outdir":   {Type: index.TypeDir},
+			"dangling": {Type: index.TypeBroken},
+		}},
+		{index.SymlinkBroken, map[string]index.Entry{
+			"in":       {Type: index.TypeFile, Size: 32},
+			"out":      {Type: index.TypeBroken},
+			"outdir":   {Type: index.TypeBroken},
+			"dangling": {Type: index.TypeBroken},
+		}},
+	}
+
+	root := makeSandboxDir(t)
+	for _, tt := range tests {
+		idx, err := index.New(
+			index.WithRoot(root),
+			index.WithSymlinks(tt.policy),
+		)
+		if err != nil {
+			t.Fatalf("error creating index: %v", err)
+		}
+
+		resp, ok := idx.Query("")
+		idx.Close()
+		if !ok {
+			t.Fatal("index query failed")
+		}
+
+		got := make(map[string]index.Entry)
+		for _, e := range resp.Contents {
+			if e.Name != "inside.dat" {
+				got[e.Name] = e
+			}
+		}
+		if len(got) != len(tt.exp) {
+			t.Errorf("policy %d: %s", tt.policy, errMsg("symlink count", len(tt.exp), len(got)))
+		}
+		for name, exp := range tt.exp {
+			e, ok := got[name]
+			if !ok {
+				t.Errorf("policy %d: missing entry %s", tt.policy, name)
+				continue
+			}
+			if e.Type != exp.Type || e.Size != exp.Size {
+				t.Errorf("policy %d: entry %s: expected %+v, got %+v", tt.policy, name, exp, e)
+			}
+		}
+	}
+}
+
+func TestQueryFS(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	fsys := fstest.MapFS{
+		"file.dat":         {Data: make([]byte, 1024), ModTime: mtime},
+		"dir/nested.dat":   {Data: make([]byte, 16), ModTime: mtime},
+		"dir/empty":        {Mode: fs.ModeDir, ModTime: mtime},
+		"dir/link.dat":     {Data: []byte("nested.dat"), Mode: fs.ModeSymlink, ModTime: mtime},
+		"dir/dangling.dat": {Data: []byte("missing.dat"), Mode: fs.ModeSymlink, ModTime: mtime},
+	}
+
+	idx, err := index.New(
+		index.WithFS(fsys),
+		index.WithSymlinks(index.SymlinkList),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	resp, ok := idx.Query("/file.dat")
+	if !ok {
+		t.Fatal("index query failed")
+	}
+	if resp.Type != index.TypeFile || resp.Size != 1024 || resp.MTime != mtime.Unix() {
+		t.Errorf("unexpected file response: %+v", resp)
+	}
+
+	resp, ok = idx.Query("/dir/")
+	if !ok {
+		t.Fatal("index query failed")
+	}
+	exp := []index.Entry{
+		{Name: "dangling.dat", Type: index.TypeBroken, MTime: mtime.Unix()},
+		{Name: "empty", Type: index.TypeDir, MTime: mtime.Unix()},
+		{Name: "link.dat", Type: index.TypeFile, Size: 16, MTime: mtime.Unix()},
+		{Name: "nested.dat", Type: index.TypeFile, Size: 16, MTime: mtime.Unix()},
+	}
+	if len(resp.Contents) != len(exp) {
+		t.Fatal(errMsg("content length", len(exp), len(resp.Contents)))
+	}
+	for n := range exp {
+		entryEq(t, exp[n], resp.Contents[n])
+	}
+
+	for _, path := range []string{"/missing", "/../missing", "/file.dat/x"} {
+		_, ok = idx.Query(path)
+		if ok {
+			t.Errorf("query %q succeeded", path)
+		}
+	}
+
+	_, err = index.New(
+		index.WithFS(fsys),
+		index.WithWatch(true),
+	)
+	if err == nil {
+		t.Error("expected error watching non-OS filesystem")
+	}
+}
+
+func TestQuerySorted(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	fsys := fstest.MapFS{
+		"b.dat": {Data: make([]byte, 30), ModTime: mtime.Add(2 * time.Hour)},
+		"a.dat": {Data: make([]byte, 20), ModTime: mtime.Add(3 * time.Hour)},
+		"c.dat": {Data: make([]byte, 10), ModTime: mtime.Add(1 * time.Hour)},
+		"z":     {Mode: fs.ModeDir, ModTime: mtime},
+		"d":     {Mode: fs.ModeDir, ModTime: mtime.Add(4 * time.Hour)},
+	}
+
+	idx, err := index.New(
+		index.WithFS(fsys),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	tests := []struct {
+		opts index.QueryOptions
+		exp  []string
+	}{
+		{index.QueryOptions{}, []string{"a.dat", "b.dat", "c.dat", "d", "z"}},
+		{index.QueryOptions{Desc: true}, []string{"z", "d", "c.dat", "b.dat", "a.dat"}},
+		{index.QueryOptions{Sort: index.SortSize}, []string{"d", "z", "c.dat", "a.dat", "b.dat"}},
+		{index.QueryOptions{Sort: index.SortMTime, Desc: true}, []string{"d", "a.dat", "b.dat", "c.dat", "z"}},
+		{index.QueryOptions{Sort: index.SortType}, []string{"d", "z", "a.dat", "b.dat", "c.dat"}},
+		{index.QueryOptions{DirsFirst: true}, []string{"d", "z", "a.dat", "b.dat", "c.dat"}},
+		{index.QueryOptions{Sort: index.SortSize, Desc: true, DirsFirst: true}, []string{"z", "d", "b.dat", "a.dat", "c.dat"}},
+	}
+
+	// Twice to cover cached views
+	for range 2 {
+		for _, tt := range tests {
+			respBytes, ok := idx.QueryWithOptions("/", tt.opts)
+			if !ok {
+				t.Fatal("index query failed")
+			}
+			var resp index.Response
+			err := json.Unmarshal(respBytes, &resp)
+			if err != nil {
+				t.Fatalf("unmarshal error: %v", err)
+			}
+			got := make([]string, 0, len(resp.Contents))
+			for _, e := range resp.Contents {
+				got = append(got, e.Name)
+			}
+			if !slices.Equal(got, tt.exp) {
+				t.Errorf("%+v: %s", tt.opts, errMsg("order", tt.exp, got))
+			}
+		}
+	}
+}
+
+func TestQueryPaged(t *testing.T) {
+	fsys := make(fstest.MapFS)
+	for n := range 25 {
+		fsys[fmt.Sprintf("%02d.dat", n)] = &fstest.MapFile{Data: make([]byte, n)}
+	}
+
+	idx, err := index.New(
+		index.WithFS(fsys),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	// Follow cursors through the listing in descending order
+	opts := index.QueryOptions{
+		Desc:  true,
+		Limit: 10,
+	}
+	var got []string
+	for pages := 1; ; pages++ {
+		respBytes, ok := idx.QueryWithOptions("", opts)
+		if !ok {
+			t.Fatal("index query failed")
+		}
+		var resp index.Response
+		err := json.Unmarshal(respBytes, &resp)
+		if err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+		if resp.Total != 25 {
+			t.Error(errMsg("total", 25, resp.Total))
+		}
+		for _, e := range resp.Contents {
+			got = append(got, e.Name)
+		}
+		if resp.NextCursor == "" {
+			if pages != 3 {
+				t.Error(errMsg("pages", 3, pages))
+			}
+			break
+		}
+		if pages == 3 {
+			t.Fatal("cursor past last page")
+		}
+		opts.Offset, err = index.DecodeCursor(resp.NextCursor)
+		if err != nil {
+			t.Fatalf("cursor error: %v", err)
+		}
+	}
+
+	if len(got) != 25 {
+		t.Fatal(errMsg("paged entries", 25, len(got)))
+	}
+	for n, name := range got {
+		exp := fmt.Sprintf("%02d.dat", 24-n)
+		if name != exp {
+			t.Error(errMsg("entry", exp, name))
+		}
+	}
+
+	// Past the end
+	resp, ok := idx.QueryWithOptions("", index.QueryOptions{Offset: 30, Limit: 10})
+	if !ok {
+		t.Fatal("index query failed")
+	}
+	if !bytes.Equal(resp, []byte(`{"type":"dir","total":25}`)) {
+		t.Errorf("unexpected page past the end: %s", resp)
+	}
+
+	_, err = index.DecodeCursor("not a cursor")
+	if err == nil {
+		t.Error("expected error decoding malformed cursor")
+	}
+}
+
+func TestQueryFiltered(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	fsys := fstest.MapFS{
+		"a.iso":      {Data: make([]byte, 300), ModTime: mtime},
+		"b.iso":      {Data: make([]byte, 100), ModTime: mtime.Add(time.Hour)},
+		"c.tar.zst":  {Data: make([]byte, 200), ModTime: mtime.Add(2 * time.Hour)},
+		"d.txt":      {Data: make([]byte, 400), ModTime: mtime.Add(3 * time.Hour)},
+		"images.iso": {Mode: fs.ModeDir, ModTime: mtime.Add(4 * time.Hour)},
+	}
+
+	idx, err := index.New(
+		index.WithFS(fsys),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	tests := []struct {
+		filter index.Filter
+		exp    []string
+	}{
+		{index.Filter{Match: "*.iso"}, []string{"a.iso", "b.iso", "images.iso"}},
+		{index.Filter{Match: "*.iso", Type: index.TypeFile}, []string{"a.iso", "b.iso"}},
+		{index.Filter{Regexp: regexp.MustCompile(`\.(iso|tar\.zst)$`)}, []string{"a.iso", "b.iso", "c.tar.zst", "images.iso"}},
+		{index.Filter{Type: index.TypeDir}, []string{"images.iso"}},
+		{index.Filter{MinSize: 200}, []string{"a.iso", "c.tar.zst", "d.txt"}},
+		{index.Filter{NewerThan: mtime.Add(90 * time.Minute)}, []string{"c.tar.zst", "d.txt", "images.iso"}},
+		{index.Filter{Match: "*.deb"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		respBytes, ok := idx.QueryWithOptions("", index.QueryOptions{
+			Filter: tt.filter,
+			Limit:  2,
+		})
+		if !ok {
+			t.Fatal("index query failed")
+		}
+		var resp index.Response
+		err := json.Unmarshal(respBytes, &resp)
+		if err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+		if resp.Total != len(tt.exp) {
+			t.Errorf("%+v: %s", tt.filter, errMsg("total", len(tt.exp), resp.Total))
+		}
+		got := make([]string, 0, len(resp.Contents))
+		for _, e := range resp.Contents {
+			got = append(got, e.Name)
+		}
+		exp := tt.exp[:min(2, len(tt.exp))]
+		if !slices.Equal(got, exp) {
+			t.Errorf("%+v: %s", tt.filter, errMsg("entries", exp, got))
+		}
+	}
+}
+
+func TestQueryExcluded(t *testing.T) {
+	fsys := fstest.MapFS{
+		".git/config":              {},
+		"visible.dat":              {},
+		"upload.part":              {},
+		"pkg/release.tar":          {},
+		"pkg/release.lock":         {},
+		"pkg/secret.key":           {},
+		"pkg/.autoindexignore":     {Data: []byte("# Keys\n*.key\n\n")},
+		"pkg/tmp/build.log":        {},
+		"other/secret.key":         {},
+		"other/tmp/build.log":      {},
+		"other/.hidden/ignored.go": {},
+	}
+
+	idx, err := index.New(
+		index.WithFS(fsys),
+		index.WithHidden(false),
+		index.WithExclude([]string{"*.part", "*.lock", "pkg/tmp"}),
+		index.WithIgnoreFile(".autoindexignore"),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	listings := map[string][]string{
+		"":       {"other", "pkg", "visible.dat"},
+		"/pkg":   {"release.tar"},
+		"/other": {"secret.key", "tmp"},
+	}
+	for path, exp := range listings {
+		resp, ok := idx.Query(path)
+		if !ok {
+			t.Fatalf("index query %q failed", path)
+		}
+		got := make([]string, 0, len(resp.Contents))
+		for _, e := range resp.Contents {
+			got = append(got, e.Name)
+		}
+		if !slices.Equal(got, exp) {
+			t.Errorf("listing %q: %s", path, errMsg("entries", exp, got))
+		}
+	}
+
+	for _, path := range []string{
+		"/.git",
+		"/.git/config",
+		"/upload.part",
+		"/pkg/release.lock",
+		"/pkg/secret.key",
+		"/pkg/.autoindexignore",
+		"/pkg/tmp",
+		"/pkg/tmp/build.log",
+		"/other/.hidden/ignored.go",
+	} {
+		_, ok := idx.Query(path)
+		if ok {
+			t.Errorf("excluded path %q found", path)
+		}
+	}
+	for _, path := range []string{"/other/secret.key", "/other/tmp/build.log"} {
+		_, ok := idx.Query(path)
+		if !ok {
+			t.Errorf("path %q not found", path)
+		}
+	}
+
+	_, err = index.New(
+		index.WithFS(fsys),
+		index.WithExclude([]string{"[a-"}),
+	)
+	if err == nil {
+		t.Error("expected error for malformed exclude pattern")
+	}
+}
+
+func TestQueryExcludedSymlinks(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{".git/config", "private/key", "public/readme"} {
+		err := os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0700)
+		if err != nil {
+			t.Fatalf("mkdir error: %v", err)
+		}
+		err = os.WriteFile(filepath.Join(root, name), nil, 0600)
+		if err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+	}
+	links := map[string]string{
+		"pub":  ".git",
+		"pub2": "private",
+		"pub3": filepath.Join(root, "private"),
+		"pub4": "public/../private/key",
+		"docs": "public",
+	}
+	for name, target := range links {
+		err := os.Symlink(target, filepath.Join(root, name))
+		if err != nil {
+			t.Fatalf("symlink error: %v", err)
+		}
+	}
+
+	idx, err := index.New(
+		index.WithRoot(root),
+		index.WithHidden(false),
+		index.WithExclude([]string{"private"}),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	resp, ok := idx.Query("")
+	if !ok {
+		t.Fatal("index query failed")
+	}
+	got := make([]string, 0, len(resp.Contents))
+	for _, e := range resp.Contents {
+		got = append(got, e.Name)
+	}
+	if exp := []string{"docs", "public"}; !slices.Equal(got, exp) {
+		t.Errorf("listing: %s", errMsg("entries", exp, got))
+	}
+
+	for _, path := range []string{"/pub", "/pub/config", "/pub2", "/pub2/key", "/pub3/key", "/pub4"} {
+		_, ok := idx.Query(path)
+		if ok {
+			t.Errorf("excluded path %q found", path)
+		}
+		_, err := idx.Open(path)
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("open %q: expected not found, got %v", path, err)
+		}
+	}
+	_, ok = idx.Query("/docs/readme")
+	if !ok {
+		t.Error("path \"/docs/readme\" not found")
+	}
+}
+
+func TestQueryTree(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/b/c/deep.dat": {},
+		"a/b/mid.dat":    {},
+		"a/top.dat":      {},
+		"x/1.dat":        {},
+		"x/2.dat":        {},
+		"root.dat":       {},
+	}
+
+	tests := []struct {
+		depth      int
+		maxDepth   int
+		maxEntries int
+		exp        string
+		truncated  bool
+	}{
+		{0, 8, 100, `[a root.dat x]`, false},
+		{1, 8, 100, `[a[b top.dat] root.dat x[1.dat 2.dat]]`, false},
+		{2, 8, 100, `[a[b[c mid.dat] top.dat] root.dat x[1.dat 2.dat]]`, false},
+		{5, 8, 100, `[a[b[c[deep.dat] mid.dat] top.dat] root.dat x[1.dat 2.dat]]`, false},
+		// Breadth first, cut short
+		{5, 8, 6, `[a[b top.dat] root.dat x[1.dat]]`, true},
+		// Capped by max depth
+		{5, 2, 100, `[a[b[c mid.dat] top.dat] root.dat x[1.dat 2.dat]]`, false},
+	}
+
+	var format func([]index.Entry) string
+	format = func(entries []index.Entry) string {
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			if e.Children != nil {
+				names = append(names, e.Name+format(e.Children))
+			} else {
+				names = append(names, e.Name)
+			}
+		}
+		return fmt.Sprint(names)
+	}
+
+	for _, tt := range tests {
+		idx, err := index.New(
+			index.WithFS(fsys),
+			index.WithMaxDepth(tt.maxDepth),
+			index.WithMaxTreeEntries(tt.maxEntries),
+		)
+		if err != nil {
+			t.Fatalf("error creating index: %v", err)
+		}
+
+		// Twice to cover the cached tree
+		for range 2 {
+			respBytes, ok := idx.QueryWithOptions("/", index.QueryOptions{Depth: tt.depth})
+			if !ok {
+				t.Fatal("index query failed")
+			}
+			var resp index.Response
+			err = json.Unmarshal(respBytes, &resp)
+			if err != nil {
+				t.Fatalf("unmarshal error: %v", err)
+			}
+			got := format(resp.Contents)
+			if got != tt.exp {
+				t.Errorf("depth %d: %s", tt.depth, errMsg("tree", tt.exp, got))
+			}
+			if resp.Truncated != tt.truncated {
+				t.Errorf("depth %d: %s", tt.depth, errMsg("truncated", tt.truncated, resp.Truncated))
+			}
+		}
+		idx.Close()
+	}
+}
+
+func TestQueryResult(t *testing.T) {
+	dirTime := time.Unix(1700000000, 0)
+	fileTime := dirTime.Add(time.Hour)
+	fsys := fstest.MapFS{
+		"dir":       &fstest.MapFile{Mode: fs.ModeDir, ModTime: dirTime},
+		"dir/a.txt": &fstest.MapFile{Data: []byte("a"), ModTime: fileTime},
+		"dir/b.txt": &fstest.MapFile{Data: []byte("bb"), ModTime: dirTime},
+	}
+
+	idx, err := index.New(
+		index.WithFS(fsys),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	// Validators survive the cache
+	var etags []string
+	for n := range 2 {
+		result, ok := idx.QueryResult("/dir", index.QueryOptions{})
+		if !ok {
+			t.Fatal("index query failed")
+		}
+		if result.MTime != fileTime.Unix() {
+			t.Error(errMsg("mtime", fileTime.Unix(), result.MTime))
+		}
+		if result.Cached != (n == 1) {
+			t.Error(errMsg("cached", n == 1, result.Cached))
+		}
+		etags = append(etags, result.ETag)
+	}
+	if etags[0] == "" || etags[0] != etags[1] {
+		t.Errorf("etag changed between queries: %v", etags)
+	}
+
+	// Views are tagged separately
+	for _, opts := range []index.QueryOptions{
+		{Desc: true},
+		{Filter: index.Filter{Match: "b*"}},
+	} {
+		result, ok := idx.QueryResult("/dir", opts)
+		if !ok {
+			t.Fatal("index query failed")
+		}
+		if result.ETag == etags[0] {
+			t.Errorf("%+v: etag of view matches listing", opts)
+		}
+		if result.Cached != (opts.Filter.Match != "") {
+			// Filtered views report whether their listing was cached
+			t.Errorf("%+v: unexpected cached %v", opts, result.Cached)
+		}
+	}
+
+	result, ok := idx.QueryResult("/dir/b.txt", index.QueryOptions{})
+	if !ok {
+		t.Fatal("index query failed")
+	}
+	if result.MTime != dirTime.Unix() {
+		t.Error(errMsg("file mtime", dirTime.Unix(), result.MTime))
+	}
+}
+
+func TestQueryCompressed(t *testing.T) {
+	fsys := make(fstest.MapFS)
+	for n := range 100 {
+		fsys[fmt.Sprintf("dir/%03d.dat", n)] = &fstest.MapFile{Data: make([]byte, n)}
+	}
+	fsys["small/a"] = &fstest.MapFile{}
+
+	idx, err := index.New(
+		index.WithFS(fsys),
+		index.WithCompression(index.Compression{
+			Levels: map[string]int{
+				index.EncodingGzip:   0,
+				index.EncodingBrotli: 11,
+				index.EncodingZstd:   3,
+			},
+			MinSize: 512,
+		}),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	decoders := map[string]func([]byte) ([]byte, error){
+		index.EncodingGzip: func(data []byte) ([]byte, error) {
+			r, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(r)
+		},
+		index.EncodingBrotli: func(data []byte) ([]byte, error) {
+			return io.ReadAll(brotli.NewReader(bytes.NewReader(data)))
+		},
+		index.EncodingZstd: func(data []byte) ([]byte, error) {
+			d, err := zstd.NewReader(nil)
+			if err != nil {
+				return nil, err
+			}
+			defer d.Close()
+			return d.DecodeAll(data, nil)
+		},
+	}
+
+	for _, opts := range []index.QueryOptions{
+		{},
+		{Desc: true},
+		{Filter: index.Filter{Match: "0*"}},
+	} {
+		// Twice to cover the cached variants
+		for range 2 {
+			result, ok := idx.QueryResult("/dir", opts)
+			if !ok {
+				t.Fatal("index query failed")
+			}
+			for encoding, decode := range decoders {
+				data, ok := idx.Encoded(result, encoding)
+				if !ok {
+					t.Fatalf("%+v: no %s variant", opts, encoding)
+				}
+				got, err := decode(data)
+				if err != nil {
+					t.Fatalf("%+v: error decoding %s: %v", opts, encoding, err)
+				}
+				if !bytes.Equal(got, result.Body) {
+					t.Errorf("%+v: %s variant does not match body", opts, encoding)
+				}
+			}
+		}
+	}
+
+	result, ok := idx.QueryResult("/small", index.QueryOptions{})
+	if !ok {
+		t.Fatal("index query failed")
+	}
+	_, ok = idx.Encoded(result, index.EncodingGzip)
+	if ok {
+		t.Error("response below min size compressed")
+	}
+	result, _ = idx.QueryResult("/dir", index.QueryOptions{})
+	_, ok = idx.Encoded(result, "deflate")
+	if ok {
+		t.Error("unconfigured encoding produced")
+	}
+
+	_, err = index.New(
+		index.WithFS(fsys),
+		index.WithCompression(index.Compression{
+			Levels: map[string]int{index.EncodingBrotli: 12},
+		}),
+	)
+	if err == nil {
+		t.Error("invalid level accepted")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	root := makeSandboxDir(t)
+	idx, err := index.New(
+		index.WithRoot(root),
+		index.WithSymlinks(index.SymlinkList),
+		index.WithExclude([]string{"dangling"}),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	for _, name := range []string{"/inside.dat", "/in", "/../inside.dat"} {
+		f, err := idx.Open(name)
+		if err != nil {
+			t.Errorf("error opening %s: %v", name, err)
+			continue
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil || len(data) != 32 {
+			t.Errorf("%s: read %d bytes: %v", name, len(data), err)
+		}
+	}
+
+	// Links out of the root are listed but never followed
+	for _, name := range []string{"/out", "/outdir/secret.dat", "/../secret.dat", "/dangling", "/missing.dat"} {
+		f, err := idx.Open(name)
+		if err == nil {
+			f.Close()
+			t.Errorf("opened %s", name)
+		}
+	}
+}
+
+func TestQueryFields(t *testing.T) {
+	fields, err := index.ParseFields("mode, inode")
+	if err != nil || fields != index.FieldMode|index.FieldInode {
+		t.Errorf("unexpected fields %d: %v", fields, err)
+	}
+	_, err = index.ParseFields("mode,size")
+	if err == nil {
+		t.Error("unknown field accepted")
+	}
+
+	fsys := fstest.MapFS{
+		"a.txt": &fstest.MapFile{Data: []byte("a"), Mode: 0640},
+		"fifo":  &fstest.MapFile{Mode: fs.ModeNamedPipe | 0600},
+		"link":  &fstest.MapFile{Data: []byte("a.txt"), Mode: fs.ModeSymlink | 0777},
+		"x":     &fstest.MapFile{Mode: fs.ModeDir | fs.ModeSticky | 0777},
+	}
+	idx, err := index.New(
+		index.WithFS(fsys),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	tests := []struct {
+		fields index.Fields
+		exp    string
+	}{
+		{0, "a.txt:file: fifo:file: link:file: x:dir:"},
+		{index.FieldMode, "a.txt:file:0640 fifo:file:0600 link:file:0640 x:dir:1777"},
+		{index.FieldType, "a.txt:file: fifo:other: link:symlink:a.txt x:dir:"},
+		{index.FieldType | index.FieldMode, "a.txt:file:0640 fifo:other:0600 link:symlink:0777a.txt x:dir:1777"},
+	}
+	for _, tt := range tests {
+		resp := queryFields(t, idx, "/", tt.fields)
+		var got []string
+		for _, e := range resp.Contents {
+			got = append(got, e.Name+":"+e.Type+":"+e.Mode+e.Target)
+		}
+		if s := strings.Join(got, " "); s != tt.exp {
+			t.Errorf("fields %d: %s", tt.fields, errMsg("entries", tt.exp, s))
+		}
+	}
+
+	// Ownership and inodes come from the OS
+	root := makeSandboxDir(t)
+	idx, err = index.New(
+		index.WithRoot(root),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	resp := queryFields(t, idx, "/", index.FieldsAll)
+	for _, e := range resp.Contents {
+		switch e.Name {
+		case "inside.dat":
+			if e.Type != index.TypeFile || e.Mode != "0600" {
+				t.Errorf("unexpected entry %+v", e)
+			}
+			if runtime.GOOS == "windows" {
+				continue
+			}
+			if e.UID == nil || int(*e.UID) != os.Getuid() || e.GID == nil || e.Inode == nil || e.Nlink == nil || *e.Nlink != 1 {
+				t.Errorf("missing ownership or inode of %+v", e)
+			}
+		case "in":
+			if e.Type != index.TypeSymlink || e.Target != "inside.dat" {
+				t.Errorf("unexpected link %+v", e)
+			}
+		case "out", "outdir", "dangling":
+			t.Errorf("link %s escaping root listed", e.Name)
+		}
+	}
+}
+
+func queryFields(t *testing.T, idx *index.Index, path string, fields index.Fields) index.Response {
+	respBytes, ok := idx.QueryWithOptions(path, index.QueryOptions{Fields: fields})
+	if !ok {
+		t.Fatal("index query failed")
+	}
+	var resp index.Response
+	err := json.Unmarshal(respBytes, &resp)
+	if err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	return resp
+}
+
+func TestQueryMIME(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	fsys := fstest.MapFS{
+		"a.json":   &fstest.MapFile{Data: []byte("{}")},
+		"image":    &fstest.MapFile{Data: png},
+		".profile": &fstest.MapFile{Data: []byte("export A=1\n")},
+		"dir":      &fstest.MapFile{Mode: fs.ModeDir},
+		"pipe.txt": &fstest.MapFile{Mode: fs.ModeNamedPipe, Data: []byte("data")},
+	}
+
+	tests := []struct {
+		sniff bool
+		exp   string
+	}{
+		{false, ".profile: a.json:application/json dir: image: pipe.txt:"},
+		{true, ".profile:text/plain; charset=utf-8 a.json:application/json dir: image:image/png pipe.txt:"},
+	}
+	for _, tt := range tests {
+		idx, err := index.New(
+			index.WithFS(fsys),
+			index.WithMIMESniff(tt.sniff),
+		)
+		if err != nil {
+			t.Fatalf("error creating index: %v", err)
+		}
+		resp := queryFields(t, idx, "/", index.FieldMIME)
+		var got []string
+		for _, e := range resp.Contents {
+			got = append(got, e.Name+":"+e.MIME)
+		}
+		if s := strings.Join(got, " "); s != tt.exp {
+			t.Errorf("sniff %v: %s", tt.sniff, errMsg("types", tt.exp, s))
+		}
+		idx.Close()
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	fsys := fstest.MapFS{
+		"a.txt":     &fstest.MapFile{Data: []byte("a"), ModTime: mtime},
+		"dir/b.txt": &fstest.MapFile{Data: []byte("b"), ModTime: mtime},
+	}
+	store := filepath.Join(t.TempDir(), "checksums.json")
+	checksums := index.Checksums{
+		Algorithms: []string{index.ChecksumSHA256, index.ChecksumMD5},
+		Store:      store,
+	}
+	exp := map[string]string{
+		index.ChecksumSHA256: "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb",
+		index.ChecksumMD5:    "0cc175b9c0f1b6a831c399e269772661",
+	}
+
+	idx, err := index.New(
+		index.WithFS(fsys),
+		index.WithChecksums(checksums),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+
+	// Listings pick up checksums once computed
+	deadline := time.Now().Add(5 * time.Second)
+	var got map[string]string
+	for got == nil && time.Now().Before(deadline) {
+		resp, ok := idx.Query("/")
+		if !ok {
+			t.Fatal("index query failed")
+		}
+		for _, e := range resp.Contents {
+			if e.Name == "a.txt" {
+				got = e.Checksums
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !maps.Equal(got, exp) {
+		t.Error(errMsg("checksums", exp, got))
+	}
+	err = idx.Close()
+	if err != nil {
+		t.Fatalf("error closing index: %v", err)
+	}
+
+	// Stored checksums are available right away
+	idx, err = index.New(
+		index.WithFS(fsys),
+		index.WithChecksums(checksums),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+	resp, ok := idx.Query("/a.txt")
+	if !ok {
+		t.Fatal("index query failed")
+	}
+	if !maps.Equal(resp.Checksums, exp) {
+		t.Error(errMsg("stored checksums", exp, resp.Checksums))
+	}
+
+	// Changed files are hashed again
+	fsys["a.txt"] = &fstest.MapFile{Data: []byte("changed"), ModTime: mtime.Add(time.Second)}
+	resp, _ = idx.Query("/dir/../a.txt") // Bypasses the cached response
+	if resp.Checksums != nil {
+		t.Errorf("checksums of changed file: %v", resp.Checksums)
+	}
+
+	_, err = index.New(
+		index.WithFS(fsys),
+		index.WithChecksums(index.Checksums{Algorithms: []string{"crc32"}}),
+	)
+	if err == nil {
+		t.Error("unknown algorithm accepted")
+	}
+}
+
+func TestUsage(t *testing.T) {
+	dir := t.TempDir()
+	newest := time.Unix(1700000000, 0)
+	write := func(name string, size int) {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0700)
+		if err != nil {
+			t.Fatalf("mkdir error: %v", err)
+		}
+		err = os.WriteFile(p, make([]byte, size), 0600)
+		if err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+		mtime := newest.Add(-time.Duration(size) * time.Second)
+		err = os.Chtimes(p, mtime, mtime)
+		if err != nil {
+			t.Fatalf("chtimes error: %v", err)
+		}
+	}
+	write("a.dat", 10)
+	write("sub/b.dat", 20)
+	write("sub/deep/c.dat", 30)
+	write("sub/.hidden", 40)
+	write("other/d.dat", 50)
+
+	idx, err := index.New(
+		index.WithRoot(dir),
+		index.WithHidden(false),
+		index.WithCache(&index.NopCache{}),
+		index.WithUsage(index.Usage{}),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+
+	// Aggregates appear once scanned, and follow changes seen by listings
+	waitForUsage := func(size int64) index.Response {
+		var resp index.Response
+		deadline := time.Now().Add(5 * time.Second)
+		for resp.Size != size && time.Now().Before(deadline) {
+			time.Sleep(20 * time.Millisecond)
+			idx.Query("/sub/deep")
+			resp, _ = idx.Query("/")
+		}
+		return resp
+	}
+
+	resp := waitForUsage(110)
+	if resp.Size != 110 || resp.Files != 4 || resp.NewestMTime != newest.Add(-10*time.Second).Unix() {
+		t.Errorf("unexpected root usage: size %d, files %d, newest %d", resp.Size, resp.Files, resp.NewestMTime)
+	}
+	for _, e := range resp.Contents {
+		if e.Name == "sub" && (e.Size != 50 || e.Files != 2 || e.NewestMTime != newest.Add(-20*time.Second).Unix()) {
+			t.Errorf("unexpected sub usage: %+v", e)
+		}
+		if e.Type == index.TypeFile && e.Files != 0 {
+			t.Errorf("usage of file %s", e.Name)
+		}
+	}
+
+	write("sub/deep/e.dat", 5)
+	resp = waitForUsage(115)
+	if resp.Size != 115 || resp.Files != 5 {
+		t.Errorf("usage not refreshed: size %d, files %d", resp.Size, resp.Files)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"Report-2024.pdf",
+		"sub/report-2025.pdf",
+		"sub/notes.txt",
+		"sub/deep/old-report.txt",
+		"other/image.png",
+		"skip.part",
+		".config/app.conf",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0700)
+		if err != nil {
+			t.Fatalf("mkdir error: %v", err)
+		}
+		err = os.WriteFile(p, []byte(name), 0600)
+		if err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+	}
+
+	idx, err := index.New(index.WithRoot(dir))
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	_, err = idx.Search(index.SearchOptions{Query: "report"})
+	if !errors.Is(err, index.ErrSearchDisabled) {
+		t.Errorf("expected disabled search, got %v", err)
+	}
+	idx.Close()
+
+	idx, err = index.New(
+		index.WithRoot(dir),
+		index.WithExclude([]string{"*.part"}),
+		index.WithCache(&index.NopCache{}),
+		index.WithSearch(index.Search{MaxResults: 3}),
+	)
+	if err != nil {
+		t.Fatalf("error creating index: %v", err)
+	}
+	defer idx.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for !idx.Crawled() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, tc := range []struct {
+		opts      index.SearchOptions
+		exp       []string
+		truncated bool
+	}{
+		{index.SearchOptions{Query: "REPORT"}, []string{"/Report-2024.pdf", "/sub/deep/old-report.txt", "/sub/report-2025.pdf"}, false},
+		{index.SearchOptions{Query: "report", Limit: 2}, []string{"/Report-2024.pdf", "/sub/deep/old-report.txt"}, true},
+		{index.SearchOptions{Query: "e"}, []string{"/Report-2024.pdf", "/other", "/other/image.png"}, true},
+		{index.SearchOptions{Query: "de"}, []string{"/sub/deep"}, false},
+		{index.SearchOptions{Query: "missing"}, []string{}, false},
+		{index.SearchOptions{Query: "skip"}, []string{}, false},
+		{index.SearchOptions{Query: "*.txt", Mode: index.SearchGlob}, []string{"/sub/deep/old-report.txt", "/sub/notes.txt"}, false},
+		{index.SearchOptions{Query: "/sub/*", Mode: index.SearchGlob}, []string{"/sub/deep", "/sub/notes.txt", "/sub/report-2025.pdf"}, false},
+		{index.SearchOptions{Query: `^report-\d+\.pdf$`, Mode: index.SearchRegexp}, []string{"/sub/report-2025.pdf"}, false},
+		{index.SearchOptions{Query: "app.conf"}, []string{"/.config/app.conf"}, false},
+		{index.SearchOptions{Query: "/.config/*", Mode: index.SearchGlob}, []string{"/.config/app.conf"}, false},
+	} {
+		resp, err := idx.Search(tc.opts)
+		if err != nil {
+			t.Errorf("search %+v error: %v", tc.opts, err)
+			continue
+		}
+		var paths []string
+		for _, r := range resp.Results {
+			paths = append(paths, r.Path)
+		}
+		if !slices.Equal(paths, tc.exp) && !(len(paths) == 0 && len(tc.exp) == 0) {
+			t.Errorf("search %+v: expected %v, got %v", tc.opts, tc.exp, paths)
+		}
+		if resp.Truncated != tc.truncated {
+			t.Errorf("search %+v: expected truncated %v", tc.opts, tc.truncated)
+		}
+	}
+
+	resp, _ := idx.Search(index.SearchOptions{Query: "notes.txt"})
+	if len(resp.Results) != 1 || resp.Results[0].Type != index.TypeFile || resp.Results[0].Size != int64(len("sub/notes.txt")) {
+		t.Errorf("unexpected entry: %+v", resp.Results)
+	}
+
+	for _, opts := range []index.SearchOptions{
+		{Query: "[", Mode: index.SearchGlob},
+		{Query: "(", Mode: index.SearchRegexp},
+		{Query: "x", Mode: "fuzzy"},
+	} {
+		_, err := idx.Search(opts)
+		if err == nil {
+			t.Errorf("search %+v: expected error", opts)
+		}
+	}
+
+	// Changes are picked up by listings of their directory
+	err = os.Remove(filepath.Join(dir, "sub", "notes.txt"))
+	if err != nil {
+		t.Fatalf("remove error: %v", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "sub", "new-report.txt"), nil, 0600)
+	if err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	idx.Query("/sub")
+	deadline = time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, _ = idx.Search(index.SearchOptions{Query: ".txt"})
+		if len(resp.Results) == 2 && resp.Results[0].Path == "/sub/deep/old-report.txt" && resp.Results[1].Path == "/sub/new-report.txt" {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(resp.Results) != 2 || resp.Results[1].Path != "/sub/new-report.txt" {
+		t.Errorf("search not refreshed: %+v", resp.Results)
+	}
+}
@@ -0,0 +1,114 @@
+package index
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+)
+
+// LRUCache is an in-process Cache evicting the least recently used entries
+// once the total size of stored values exceeds its limit.
+type LRUCache struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List // Front is most recently used
+	size     int
+	maxBytes int
+
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type lruEntry struct {
+	key   string
+	value []byte
+}
+
+// NewLRUCache creates an LRUCache holding at most maxBytes of values
+func NewLRUCache(maxBytes int) *LRUCache {
+	return &LRUCache{
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		maxBytes: maxBytes,
+	}
+}
+
+func (c *LRUCache) Get(key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, ErrCacheMiss
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).value, nil
+}
+
+func (c *LRUCache) Set(key string, value []byte) error {
+	if len(value) > c.maxBytes {
+		return errors.New("entry is bigger than cache size")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	for c.size+len(value) > c.maxBytes {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{
+		key:   key,
+		value: value,
+	})
+	c.size += len(value)
+	return nil
+}
+
+func (c *LRUCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return ErrCacheMiss
+	}
+	c.remove(el)
+	return nil
+}
+
+// Caller must hold c.mu
+func (c *LRUCache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*lruEntry)
+	delete(c.entries, e.key)
+	c.size -= len(e.value)
+}
+
+func (c *LRUCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   len(c.entries),
+		Bytes:     c.size,
+	}
+}
+
+func (c *LRUCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+	c.order.Init()
+	c.size = 0
+	return nil
+}
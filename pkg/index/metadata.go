@@ -0,0 +1,204 @@
+package index
+
+import (
+	"fmt"
+	"io/fs"
+	"mime"
+	"os/user"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// Fields selects extended metadata of listing entries
+type Fields uint8
+
+const (
+	FieldMode  Fields = 1 << iota // Permission bits
+	FieldOwner                    // Owning user and group
+	FieldInode                    // Inode number and link count
+	FieldType                     // TypeSymlink with target and TypeOther instead of the target's type and TypeFile
+	FieldMIME                     // Content type of files
+
+	FieldsAll = FieldMode | FieldOwner | FieldInode | FieldType | FieldMIME
+)
+
+var fieldNames = map[string]Fields{
+	"mode":  FieldMode,
+	"owner": FieldOwner,
+	"inode": FieldInode,
+	"type":  FieldType,
+	"mime":  FieldMIME,
+	"all":   FieldsAll,
+}
+
+// ParseFields parses a comma separated list of field names: mode, owner,
+// inode, type, mime or all
+func ParseFields(s string) (Fields, error) {
+	var f Fields
+	for name := range strings.SplitSeq(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		v, ok := fieldNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown field %q", name)
+		}
+		f |= v
+	}
+	return f, nil
+}
+
+// Platform specific metadata, see sysMetadata
+type sysInfo struct {
+	uid   uint32
+	gid   uint32
+	inode uint64
+	nlink uint64
+}
+
+// Add the extended metadata selected by fields to en, described by info as
+// returned by lstat. Fields the platform cannot provide are left unset.
+func (i *Index) extend(en *Entry, dir string, info fs.FileInfo, fields Fields) {
+	if info.Mode()&fs.ModeSymlink != 0 && fields&FieldType == 0 && en.Type != TypeBroken {
+		// Describe the target like the rest of the entry
+		target, err := fs.Stat(i.fsys, path.Join(dir, info.Name()))
+		if err == nil {
+			info = target
+		}
+	}
+
+	mode := info.Mode()
+	if fields&FieldMode != 0 {
+		en.Mode = unixMode(mode)
+	}
+	if fields&FieldType != 0 {
+		switch {
+		case mode&fs.ModeSymlink != 0:
+			en.Type = TypeSymlink
+			en.Size = 0
+			target, err := fs.ReadLink(i.fsys, path.Join(dir, info.Name()))
+			if err != nil {
+				i.logger.Warnf("error reading symlink %s/%s: %v", dir, info.Name(), err)
+			}
+			en.Target = target
+		case !mode.IsDir() && !mode.IsRegular():
+			en.Type = TypeOther
+			en.Size = 0
+		}
+	}
+
+	// Opening pipes or devices for sniffing could block
+	if fields&FieldMIME != 0 && en.Type == TypeFile && mode.IsRegular() {
+		en.MIME = i.detectMIME(path.Join(dir, info.Name()))
+	}
+
+	if fields&(FieldOwner|FieldInode) == 0 {
+		return
+	}
+	sys, ok := sysMetadata(info)
+	if !ok {
+		return
+	}
+	if fields&FieldOwner != 0 {
+		en.UID = &sys.uid
+		en.GID = &sys.gid
+		en.User = i.owners.user(sys.uid)
+		en.Group = i.owners.group(sys.gid)
+	}
+	if fields&FieldInode != 0 {
+		en.Inode = &sys.inode
+		en.Nlink = &sys.nlink
+	}
+}
+
+// Content type of the file name by its extension, or by its contents if
+// sniffing is enabled. Empty if unknown.
+func (i *Index) detectMIME(name string) string {
+	ext := path.Ext(name)
+	if strings.HasPrefix(path.Base(name), ".") && ext == path.Base(name) {
+		// Dotfiles have no extension
+		ext = ""
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	if !i.mimeSniff {
+		return ""
+	}
+
+	f, err := i.fsys.Open(name)
+	if err != nil {
+		i.logger.Warnf("error opening %s for sniffing: %v", name, err)
+		return ""
+	}
+	defer f.Close()
+	m, err := mimetype.DetectReader(f)
+	if err != nil {
+		i.logger.Warnf("error sniffing %s: %v", name, err)
+		return ""
+	}
+	return m.String()
+}
+
+// Permission bits as in chmod
+func unixMode(m fs.FileMode) string {
+	perm := uint32(m.Perm())
+	if m&fs.ModeSetuid != 0 {
+		perm |= 0o4000
+	}
+	if m&fs.ModeSetgid != 0 {
+		perm |= 0o2000
+	}
+	if m&fs.ModeSticky != 0 {
+		perm |= 0o1000
+	}
+	return fmt.Sprintf("%04o", perm)
+}
+
+// Cache of user and group names by id, ids without a name map to ""
+type ownerNames struct {
+	mu     sync.Mutex
+	users  map[uint32]string
+	groups map[uint32]string
+}
+
+func (o *ownerNames) user(uid uint32) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	name, ok := o.users[uid]
+	if !ok {
+		u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+		if err == nil {
+			name = u.Username
+		}
+		if o.users == nil {
+			o.users = make(map[uint32]string)
+		}
+		o.users[uid] = name
+	}
+	return name
+}
+
+func (o *ownerNames) group(gid uint32) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	name, ok := o.groups[gid]
+	if !ok {
+		g, err := user.LookupGroupId(strconv.FormatUint(uint64(gid), 10))
+		if err == nil {
+			name = g.Name
+		}
+		if o.groups == nil {
+			o.groups = make(map[uint32]string)
+		}
+		o.groups[gid] = name
+	}
+	return name
+}
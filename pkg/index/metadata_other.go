@@ -0,0 +1,10 @@
+//go:build !unix
+
+package index
+
+import "io/fs"
+
+// Ownership and inodes are unix concepts
+func sysMetadata(info fs.FileInfo) (sysInfo, bool) {
+	return sysInfo{}, false
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package index
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func sysMetadata(info fs.FileInfo) (sysInfo, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return sysInfo{}, false
+	}
+	return sysInfo{
+		uid:   st.Uid,
+		gid:   st.Gid,
+		inode: uint64(st.Ino),
+		nlink: uint64(st.Nlink),
+	}, true
+}
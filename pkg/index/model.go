@@ -1,20 +1,81 @@
 package index
 
 const (
-	TypeFile = "file"
-	TypeDir  = "dir"
+	TypeFile   = "file"
+	TypeDir    = "dir"
+	TypeBroken = "broken" // Symlink not resolvable inside the root
+
+	// Only with FieldType
+	TypeSymlink = "symlink"
+	TypeOther   = "other" // Devices, sockets and pipes
 )
 
 type Response struct {
-	Type     string  `json:"type"` // "file" or "dir"
-	MTime    int64   `json:"mtime,omitempty"`
+	Type     string  `json:"type"`            // "file" or "dir"
+	MTime    int64   `json:"mtime,omitempty"` // Unix timestamp
 	Size     int64   `json:"size,omitempty"`
 	Contents []Entry `json:"content,omitempty"`
+
+	Checksums map[string]string `json:"checksums,omitempty"` // By algorithm, once computed
+
+	// Recursive usage of directories, once aggregated. Size is the total.
+	Files       int64 `json:"files,omitempty"`
+	NewestMTime int64 `json:"newest_mtime,omitempty"`
+
+	// Set for paged listings
+	Total      int    `json:"total,omitempty"`       // Entries in the full listing
+	NextCursor string `json:"next_cursor,omitempty"` // Cursor of the next page, empty on the last
+
+	// Set when a tree listing hit the entry limit
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 type Entry struct {
 	Name  string `json:"name"`
-	Type  string `json:"type"`  // "file" or "dir"
+	Type  string `json:"type"`  // One of the Type constants
 	MTime int64  `json:"mtime"` // Unix timestamp
 	Size  int64  `json:"size,omitempty"`
+
+	// Extended metadata selected by Fields
+	Mode   string  `json:"mode,omitempty"` // Octal permission bits
+	UID    *uint32 `json:"uid,omitempty"`
+	GID    *uint32 `json:"gid,omitempty"`
+	User   string  `json:"user,omitempty"`
+	Group  string  `json:"group,omitempty"`
+	Inode  *uint64 `json:"inode,omitempty"`
+	Nlink  *uint64 `json:"nlink,omitempty"`
+	Target string  `json:"target,omitempty"` // Of symlinks
+	MIME   string  `json:"mime,omitempty"`   // Content type of files
+
+	Checksums map[string]string `json:"checksums,omitempty"` // Of files by algorithm, once computed
+
+	// Recursive usage of directories, once aggregated. Size is the total.
+	Files       int64 `json:"files,omitempty"`
+	NewestMTime int64 `json:"newest_mtime,omitempty"`
+
+	Children []Entry `json:"children,omitempty"` // Contents of directories in tree listings
+}
+
+// Result is a response body with validators for conditional requests
+type Result struct {
+	Body   []byte
+	ETag   string // Hash of Body
+	MTime  int64  // Latest modification time of anything in Body
+	Cached bool   // Whether Body was served from the cache
+
+	key    string // Cache key, empty for uncached views
+	header cacheHeader
+}
+
+// Listings also change when their entries do
+func (r Response) lastModified() int64 {
+	return max(r.MTime, latestMTime(r.Contents))
+}
+
+func latestMTime(entries []Entry) int64 {
+	var mtime int64
+	for _, e := range entries {
+		mtime = max(mtime, e.MTime, latestMTime(e.Children))
+	}
+	return mtime
 }
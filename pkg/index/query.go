@@ -3,8 +3,12 @@ package index
 import (
 	"encoding/binary"
 	"errors"
-	"os"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,134 +30,387 @@ func (i *Index) Query(path string) (Response, bool) {
 }
 
 func (i *Index) QueryBytes(path string) ([]byte, bool) {
+	result, ok := i.query(path, 0)
+	return result.Body, ok
+}
+
+// Query path for a listing with the extended metadata selected by fields
+func (i *Index) query(path string, fields Fields) (Result, bool) {
 	// Strip trailing slash to avoid duplicate cache
 	path = strings.TrimSuffix(path, "/")
 	i.logger.Debugf("query \"%s\"", path)
+	if strings.IndexByte(path, 0) >= 0 {
+		// NUL separates cache key suffixes
+		return Result{}, false
+	}
+
+	key := path
+	if fields != 0 {
+		key = path + "\x00" + QueryOptions{Fields: fields}.variant()
+	}
 
 	// Lookup cache
-	respBytes, ok := i.queryCache(path)
+	result, ok := i.queryCache(key)
 	if ok {
-		return respBytes, true
+		return result, true
 	}
 
 	// Query filesystem
-	resp, ok := i.queryFilesystem(path)
+	read := i.beginRead(path)
+	defer read.end()
+	resp, ok := i.queryFilesystem(path, fields)
 	if !ok {
 		i.logger.Debugf("not found on filesystem: %s", path)
-		return nil, false
+		return Result{}, false
 	}
 
 	respBytes, err := sonic.Marshal(resp)
 	if err != nil {
 		i.logger.Errorf("error marshaling response json")
-		return nil, false
+		return Result{}, false
 	}
 
 	// Cache response
-	err = i.putCache(path, respBytes)
+	header := i.newHeader(respBytes, resp.lastModified())
+	read.store(key, respBytes, header)
+
+	return header.result(key, respBytes), true
+}
+
+// A read of path from the filesystem whose result is cached unless path
+// changes before it is stored
+type pendingRead struct {
+	index   *Index
+	path    string
+	name    string // Watched filesystem path
+	isDir   bool
+	changes uint64
+	watched bool // Whether the watch was set up before the read
+	done    bool
+}
+
+// Start watching path ahead of reading it. The read must be finished with
+// store or end.
+func (i *Index) beginRead(path string) *pendingRead {
+	r := &pendingRead{
+		index: i,
+		path:  path,
+		name:  filepath.Join(i.root, path),
+	}
+	if i.watcher == nil {
+		return r
+	}
+	info, err := fs.Stat(i.fsys, rootName(path))
 	if err != nil {
-		i.logger.Errorf("error saving response to cache")
+		return r
 	}
+	r.isDir = info.IsDir()
+	r.changes, r.watched = i.watcher.begin(r.name, r.isDir)
+	return r
+}
+
+// Cache body under key, tracking it for invalidation when path changes.
+// Nothing is cached if path changed during the read.
+func (r *pendingRead) store(key string, body []byte, header cacheHeader) {
+	i := r.index
+	err := i.putCache(key, body, header)
+	if err != nil {
+		i.logger.Errorf("error saving response to cache: %v", err)
+		return
+	}
+	switch {
+	case i.watcher == nil:
+	case !r.watched:
+		// Couldn't watch ahead, track from now on
+		i.watcher.track(r.name, key, r.isDir)
+	case !i.watcher.commit(r.name, key, r.changes):
+		i.logger.Debugf("\"%s\" changed while reading, dropping \"%s\"", r.path, key)
+		i.cache.Delete(key)
+	}
+	r.done = true
+}
 
-	return respBytes, true
+// End the read, no-op after store
+func (r *pendingRead) end() {
+	if r.done {
+		return
+	}
+	r.done = true
+	if r.watched {
+		r.index.watcher.end(r.name)
+	}
 }
 
+const (
+	cacheHeaderSize = 36
+	chunkHeaderSize = 8
+
+	// Room left in every entry for key and cache bookkeeping
+	entryOverhead = 64
+)
+
 type cacheHeader struct {
-	ExpiresAt int64 // Unix timestamp
+	ExpiresAt  int64  // Unix timestamp
+	Generation uint64 // Shared by the head entry and its chunks
+	Hash       uint64 // FNV-1a of the whole response
+	MTime      int64  // Latest modification time in the response
+	Chunks     uint32 // Number of chunks following the head entry
+}
+
+func (i *Index) newHeader(respBytes []byte, mtime int64) cacheHeader {
+	h := fnv.New64a()
+	h.Write(respBytes)
+	return cacheHeader{
+		ExpiresAt:  time.Now().Add(i.ttl).Unix(),
+		Generation: i.generation.Add(1),
+		Hash:       h.Sum64(),
+		MTime:      mtime,
+	}
+}
+
+func (h cacheHeader) result(key string, body []byte) Result {
+	return Result{
+		Body:   body,
+		ETag:   strconv.FormatUint(h.Hash, 16),
+		MTime:  h.MTime,
+		key:    key,
+		header: h,
+	}
 }
 
 // Use special header to handle expiry
-func (i *Index) queryCache(path string) ([]byte, bool) {
+func (i *Index) queryCache(path string) (Result, bool) {
 	respBytes, err := i.cache.Get(path)
-	if err == nil {
-		header, body, err := extractHeader(respBytes)
+	if err != nil {
+		i.logger.Debugf("cache miss for \"%s\"", path)
+		return Result{}, false
+	}
+	header, body, err := extractHeader(respBytes)
+	if err != nil {
+		i.logger.Errorf("error extracting header: %v", err)
+		return Result{}, false
+	}
+	if time.Now().Unix() >= header.ExpiresAt {
+		i.logger.Debugf("cache expired for \"%s\"", path)
+		i.expirations.Add(1)
+		return Result{}, false
+	}
+	if header.Chunks > 0 {
+		body, err = i.readChunks(path, header, body)
+		if err != nil {
+			i.logger.Debugf("cache miss for \"%s\": %v", path, err)
+			return Result{}, false
+		}
+	}
+	i.logger.Debugf("cache hit for \"%s\"", path)
+	result := header.result(path, body)
+	result.Cached = true
+	return result, true
+}
+
+// Cache a response along with its compressed variants
+func (i *Index) putCache(path string, respBytes []byte, header cacheHeader) error {
+	err := i.putEntry(path, respBytes, header)
+	if err != nil {
+		return err
+	}
+	i.putEncoded(path, respBytes, header)
+	return nil
+}
+
+func (i *Index) putEntry(path string, respBytes []byte, header cacheHeader) error {
+	headSize := i.maxEntrySize - entryOverhead - len(path) - cacheHeaderSize
+	if headSize <= 0 {
+		return errors.New("path too long for max entry size")
+	}
+	if len(respBytes) <= headSize {
+		return i.cache.Set(path, prependHeader(respBytes, header))
+	}
+
+	// Write chunks before the head so readers never see a partial set
+	head, rest := respBytes[:headSize], respBytes[headSize:]
+	for len(rest) > 0 {
+		key := chunkKey(path, header.Chunks+1)
+		n := min(len(rest), i.maxEntrySize-entryOverhead-len(key)-chunkHeaderSize)
+		if n <= 0 {
+			return errors.New("path too long for max entry size")
+		}
+		err := i.cache.Set(key, prependChunkHeader(rest[:n], header.Generation))
+		if err != nil {
+			return fmt.Errorf("error saving chunk %d: %w", header.Chunks+1, err)
+		}
+		rest = rest[n:]
+		header.Chunks++
+	}
+	return i.cache.Set(path, prependHeader(head, header))
+}
+
+// Reassemble a response split across chunks by putCache
+func (i *Index) readChunks(path string, header cacheHeader, head []byte) ([]byte, error) {
+	body := make([]byte, 0, len(head)*int(header.Chunks+1))
+	body = append(body, head...)
+	for n := uint32(1); n <= header.Chunks; n++ {
+		data, err := i.cache.Get(chunkKey(path, n))
 		if err != nil {
-			i.logger.Errorf("error extracting header: %v", err)
-			return nil, false
+			return nil, fmt.Errorf("chunk %d: %w", n, err)
+		}
+		if len(data) < chunkHeaderSize {
+			return nil, fmt.Errorf("chunk %d: not enough bytes", n)
 		}
-		if time.Now().Unix() >= header.ExpiresAt {
-			i.logger.Debugf("cache expired for \"%s\"", path)
-			return nil, false
+		if binary.BigEndian.Uint64(data[:chunkHeaderSize]) != header.Generation {
+			return nil, fmt.Errorf("chunk %d: generation mismatch", n)
 		}
-		i.logger.Debugf("cache hit for \"%s\"", path)
-		return body, true
+		body = append(body, data[chunkHeaderSize:]...)
 	}
-	i.logger.Debugf("cache miss for \"%s\"", path)
-	return nil, false
+	return body, nil
 }
 
-func (i *Index) putCache(path string, respBytes []byte) error {
-	data := prependHeader(respBytes, cacheHeader{
-		ExpiresAt: time.Now().Add(i.ttl).Unix(),
-	})
-	return i.cache.Set(path, data)
+func chunkKey(path string, n uint32) string {
+	return path + "\x00" + strconv.FormatUint(uint64(n), 10)
 }
 
 func extractHeader(data []byte) (cacheHeader, []byte, error) {
-	if len(data) < 8 {
+	if len(data) < cacheHeaderSize {
 		return cacheHeader{}, nil, errors.New("not enough bytes")
 	}
 	header := cacheHeader{
-		ExpiresAt: int64(binary.BigEndian.Uint64(data[:8])),
+		ExpiresAt:  int64(binary.BigEndian.Uint64(data[:8])),
+		Generation: binary.BigEndian.Uint64(data[8:16]),
+		Hash:       binary.BigEndian.Uint64(data[16:24]),
+		MTime:      int64(binary.BigEndian.Uint64(data[24:32])),
+		Chunks:     binary.BigEndian.Uint32(data[32:36]),
 	}
-	return header, data[8:], nil
+	return header, data[cacheHeaderSize:], nil
 }
 
 func prependHeader(body []byte, header cacheHeader) []byte {
-	buf := make([]byte, 8+len(body))
+	buf := make([]byte, cacheHeaderSize+len(body))
 	binary.BigEndian.PutUint64(buf[:8], uint64(header.ExpiresAt))
-	copy(buf[8:], body)
+	binary.BigEndian.PutUint64(buf[8:16], header.Generation)
+	binary.BigEndian.PutUint64(buf[16:24], header.Hash)
+	binary.BigEndian.PutUint64(buf[24:32], uint64(header.MTime))
+	binary.BigEndian.PutUint32(buf[32:36], header.Chunks)
+	copy(buf[cacheHeaderSize:], body)
+	return buf
+}
+
+func prependChunkHeader(body []byte, generation uint64) []byte {
+	buf := make([]byte, chunkHeaderSize+len(body))
+	binary.BigEndian.PutUint64(buf[:chunkHeaderSize], generation)
+	copy(buf[chunkHeaderSize:], body)
 	return buf
 }
 
-func (i *Index) queryFilesystem(path string) (Response, bool) {
+func (i *Index) queryFilesystem(p string, fields Fields) (Response, bool) {
 	var resp Response
-	path = filepath.Join(i.root, path)
-
-	entries, err := os.ReadDir(path)
-	if err == nil {
-		// Handle directory
-		resp.Type = TypeDir
-		resp.Contents = make([]Entry, 0, len(entries))
-
-		for _, e := range entries {
-			info, err := e.Info()
-			if err != nil {
-				i.logger.Warnf("error getting info of entry %s/%s: %v", path, e.Name(), err)
+	name := rootName(p)
+	if i.targetExcluded(name) {
+		i.logger.Debugf("path %s excluded", name)
+		return resp, false
+	}
+
+	info, err := fs.Stat(i.fsys, name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			i.logger.Debugf("path %s not found", name)
+			return resp, false
+		}
+		i.logger.Errorf("error opening path %s: %v", name, err)
+		i.readErrors.Add(1)
+		return resp, false
+	}
+
+	if !info.IsDir() {
+		// Handle file
+		resp = Response{
+			Type:  TypeFile,
+			MTime: info.ModTime().Unix(),
+			Size:  info.Size(),
+		}
+		resp.Checksums = i.fileChecksums(name, info)
+		return resp, true
+	}
+
+	// Handle directory
+	entries, err := fs.ReadDir(i.fsys, name)
+	if err != nil {
+		i.logger.Errorf("error reading directory %s: %v", name, err)
+		i.readErrors.Add(1)
+		return resp, false
+	}
+
+	resp.Type = TypeDir
+	if !info.ModTime().IsZero() {
+		// Synthesized directories of some filesystems have no mtime
+		resp.MTime = info.ModTime().Unix()
+	}
+	if i.crawler != nil {
+		// Catch up with changes seen by this read
+		i.crawler.touch(name)
+	}
+	if i.aggregator != nil {
+		if u, ok := i.dirUsage(name); ok {
+			resp.Size, resp.Files, resp.NewestMTime = u.size, u.files, u.newest
+		}
+	}
+	resp.Contents = make([]Entry, 0, len(entries))
+
+	var ignored []string
+	if i.excludes() {
+		ignored = i.ignorePatterns(name)
+	}
+
+	for _, e := range entries {
+		if i.excludes() && i.excluded(name, e.Name(), ignored) {
+			continue
+		}
+		isLink := e.Type()&fs.ModeSymlink != 0
+		var en Entry
+		if isLink {
+			var ok bool
+			en, ok = i.resolveSymlink(name, e)
+			if !ok {
 				continue
 			}
-			en := Entry{
-				Name:  info.Name(),
-				MTime: info.ModTime().Unix(),
+			if fields == 0 {
+				resp.Contents = append(resp.Contents, en)
+				continue
 			}
+		}
+		info, err := e.Info()
+		if err != nil {
+			i.logger.Warnf("error getting info of entry %s/%s: %v", name, e.Name(), err)
+			i.readErrors.Add(1)
+			continue
+		}
+		if !isLink {
+			en = entryFromInfo(info)
+			entryName := path.Join(name, info.Name())
+			en.Checksums = i.fileChecksums(entryName, info)
 			if info.IsDir() {
-				en.Type = TypeDir
-			} else {
-				en.Size = info.Size()
-				en.Type = TypeFile
+				if u, ok := i.dirUsage(entryName); ok {
+					en.Size, en.Files, en.NewestMTime = u.size, u.files, u.newest
+				}
 			}
-			resp.Contents = append(resp.Contents, en)
 		}
-		return resp, true
-	}
-
-	i.logger.Debugf("readdir error: %v", err)
-	i.logger.Debugf("retrying as file")
-
-	// Handle file
-	info, err := os.Stat(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			i.logger.Debugf("path %s not found", path)
-			return resp, false
+		if fields != 0 {
+			i.extend(&en, name, info, fields)
 		}
-		i.logger.Errorf("error opening path %s: %v", path, err)
-		return resp, false
+		resp.Contents = append(resp.Contents, en)
 	}
+	return resp, true
+}
 
-	return Response{
-		Type:  TypeFile,
+func entryFromInfo(info fs.FileInfo) Entry {
+	en := Entry{
+		Name:  info.Name(),
 		MTime: info.ModTime().Unix(),
-		Size:  info.Size(),
-	}, true
+	}
+	if info.IsDir() {
+		en.Type = TypeDir
+	} else {
+		en.Size = info.Size()
+		en.Type = TypeFile
+	}
+	return en
 }
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/HT4w5/autoindex/pkg/log"
+	"github.com/docker/go-units"
 )
 
 const (
@@ -70,15 +71,22 @@ func BenchmarkQueryFilesystem(b *testing.B) {
 	binary.BigEndian.PutUint64(seedBytes[:], seed)
 	r := rand.New(rand.NewChaCha8(seedBytes))
 	dir := makeBenchmarkDir(b, r, nFiles, nDirs)
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		b.Fatalf("failed to open root: %v", err)
+	}
+	defer root.Close()
 	idx := Index{
 		root:   dir,
+		fsys:   root.FS(),
+		fsroot: root,
 		logger: &log.DiscardLogger{},
 	}
 
 	b.ResetTimer()
 
 	for range b.N {
-		_, ok := idx.queryFilesystem("")
+		_, ok := idx.queryFilesystem("", 0)
 		if !ok {
 			b.Fatal("query failed")
 		}
@@ -90,26 +98,93 @@ func BenchmarkQueryCache(b *testing.B) {
 	binary.BigEndian.PutUint64(seedBytes[:], seed)
 	r := rand.New(rand.NewChaCha8(seedBytes))
 	dir := makeBenchmarkDir(b, r, nFiles, nDirs)
+
+	backends := map[string]func() (Cache, error){
+		"bigcache": func() (Cache, error) {
+			return NewBigCache(10, 10*units.KB, 10*time.Minute)
+		},
+		"lru": func() (Cache, error) {
+			return NewLRUCache(10 * units.MB), nil
+		},
+		"none": func() (Cache, error) {
+			return &NopCache{}, nil
+		},
+	}
+
+	for name, newCache := range backends {
+		b.Run(name, func(b *testing.B) {
+			cache, err := newCache()
+			if err != nil {
+				b.Fatalf("failed to create cache: %v", err)
+			}
+			idx, err := New(
+				WithLogger(&log.DiscardLogger{}),
+				WithRoot(dir),
+				WithTTL(10*time.Minute),
+				WithCache(cache),
+			)
+			if err != nil {
+				b.Fatalf("failed to create index: %v", err)
+			}
+			defer idx.Close()
+
+			_, ok := idx.QueryBytes("/")
+			if !ok {
+				b.Fatal("query failed")
+			}
+
+			b.ResetTimer()
+
+			for range b.N {
+				_, ok := idx.QueryBytes("/")
+				if !ok {
+					b.Fatal("query failed")
+				}
+			}
+		})
+	}
+}
+
+func TestStoreChangedDuringRead(t *testing.T) {
+	dir := t.TempDir()
 	idx, err := New(
-		WithLogger(&log.DiscardLogger{}),
 		WithRoot(dir),
-		WithTTL(10*time.Minute),
+		WithTTL(time.Hour),
+		WithWatch(true),
 	)
 	if err != nil {
-		b.Fatalf("failed to create index: %v", err)
+		t.Fatalf("error creating index: %v", err)
 	}
+	defer idx.Close()
 
-	_, ok := idx.QueryBytes("/")
-	if !ok {
-		b.Fatal("query failed")
+	read := idx.beginRead("")
+	defer read.end()
+	if !read.watched {
+		t.Fatal("expected root to be watched ahead of the read")
 	}
 
-	b.ResetTimer()
-
-	for range b.N {
-		_, ok := idx.QueryBytes("/")
-		if !ok {
-			b.Fatal("query failed")
+	// Change lands after the read but before the result is stored
+	err = os.WriteFile(filepath.Join(dir, "new.dat"), nil, 0600)
+	if err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		idx.watcher.mu.Lock()
+		changes := idx.watcher.paths[read.name].changes
+		idx.watcher.mu.Unlock()
+		if changes != read.changes {
+			break
 		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for watch event")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	body := []byte("{}")
+	read.store("", body, idx.newHeader(body, 0))
+	if _, ok := idx.queryCache(""); ok {
+		t.Error("expected stale listing not to be cached")
 	}
 }
@@ -0,0 +1,149 @@
+package index
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkPolicy controls how symlinks that cannot be resolved inside the
+// root are shown in listings. Querying through them is never allowed.
+type SymlinkPolicy int
+
+const (
+	// Omit them from listings
+	SymlinkHide SymlinkPolicy = iota
+	// List them with the metadata of their target
+	SymlinkList
+	// List them as TypeBroken
+	SymlinkBroken
+)
+
+// Convert a query path into a name valid for fs.FS
+func rootName(p string) string {
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// Links followed resolving a name before giving up, as in Linux
+const maxSymlinks = 40
+
+// Resolve the symlinks in name, returning the name it refers to inside the
+// root. Reports false for names leaving the root. Missing elements end the
+// resolution, the rest of name is kept as is.
+func (i *Index) realName(name string) (string, bool) {
+	rest := strings.Split(name, "/")
+	real := "."
+	links := 0
+	for len(rest) > 0 {
+		elem := rest[0]
+		rest = rest[1:]
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if real == "." {
+				return "", false
+			}
+			real = path.Dir(real)
+			continue
+		}
+
+		next := path.Join(real, elem)
+		info, err := fs.Lstat(i.fsys, next)
+		if err != nil {
+			return path.Join(append([]string{next}, rest...)...), true
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			real = next
+			continue
+		}
+		links++
+		if links > maxSymlinks {
+			return "", false
+		}
+		target, err := fs.ReadLink(i.fsys, next)
+		if err != nil {
+			return "", false
+		}
+		if path.IsAbs(filepath.ToSlash(target)) {
+			// Absolute targets can only lead back into an OS root
+			if i.fsroot == nil {
+				return "", false
+			}
+			root, err := filepath.Abs(i.root)
+			if err != nil {
+				return "", false
+			}
+			rel, err := filepath.Rel(root, target)
+			if err != nil || !filepath.IsLocal(rel) {
+				return "", false
+			}
+			real, target = ".", rel
+		}
+		rest = append(strings.Split(filepath.ToSlash(target), "/"), rest...)
+	}
+	return real, true
+}
+
+// Reports whether name, or what it refers to through symlinks, is excluded
+func (i *Index) targetExcluded(name string) bool {
+	if i.pathExcluded(name) {
+		return true
+	}
+	if !i.excludes() {
+		return false
+	}
+	real, ok := i.realName(name)
+	return ok && real != name && i.pathExcluded(real)
+}
+
+// Build the entry for a symlink in directory dir. Links resolving inside the
+// root describe their target unless it is excluded, others are subject to
+// the symlink policy.
+func (i *Index) resolveSymlink(dir string, e fs.DirEntry) (Entry, bool) {
+	name := path.Join(dir, e.Name())
+
+	info, err := fs.Stat(i.fsys, name)
+	if err == nil {
+		if i.targetExcluded(name) {
+			i.logger.Debugf("symlink %s points to an excluded path", name)
+			return Entry{}, false
+		}
+		en := entryFromInfo(info)
+		en.Name = e.Name()
+		return en, true
+	}
+	i.logger.Debugf("symlink %s unresolvable inside root: %v", name, err)
+
+	switch i.symlinks {
+	case SymlinkList:
+		// Targets outside the root only exist on the OS filesystem,
+		// dangling links have no target to list
+		if i.fsroot != nil {
+			info, err := os.Stat(filepath.Join(i.root, filepath.FromSlash(name)))
+			if err == nil {
+				en := entryFromInfo(info)
+				en.Name = e.Name()
+				return en, true
+			}
+		}
+		fallthrough
+	case SymlinkBroken:
+		en := Entry{
+			Name: e.Name(),
+			Type: TypeBroken,
+		}
+		info, err := e.Info()
+		if err == nil {
+			en.MTime = info.ModTime().Unix()
+		}
+		return en, true
+	}
+	return Entry{}, false
+}
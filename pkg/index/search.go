@@ -0,0 +1,242 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Search modes
+const (
+	SearchSubstring = "substring"
+	SearchGlob      = "glob"
+	SearchRegexp    = "regex"
+)
+
+// ErrSearchDisabled is returned by Search unless enabled with WithSearch
+var ErrSearchDisabled = errors.New("search disabled")
+
+// Search configures the in-memory filename index of the whole tree
+type Search struct {
+	Interval   time.Duration // Between full crawls, defaults to an hour
+	MaxResults int           // Cap of SearchOptions.Limit, defaults to 1000
+}
+
+type SearchOptions struct {
+	Query string
+	Mode  string // One of the Search constants, empty for substrings
+	Limit int    // Zero for the maximum
+}
+
+// SearchResult is an entry found by Search along with its path
+type SearchResult struct {
+	Path string `json:"path"`
+	Entry
+}
+
+type SearchResponse struct {
+	Results   []SearchResult `json:"results"`
+	Truncated bool           `json:"truncated,omitempty"` // More entries matched than returned
+}
+
+type trigram [3]byte
+
+// Filename index, substring searches are narrowed down by the trigrams of
+// lower case names
+type searchIndex struct {
+	mu       sync.RWMutex
+	docs     map[uint32]*searchDoc
+	byDir    map[string][]uint32 // Root relative directory -> docs of its entries
+	postings map[trigram]map[uint32]struct{}
+	nextID   uint32
+}
+
+type searchDoc struct {
+	dir   string
+	entry Entry
+	lower string
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		docs:     make(map[uint32]*searchDoc),
+		byDir:    make(map[string][]uint32),
+		postings: make(map[trigram]map[uint32]struct{}),
+	}
+}
+
+func trigrams(s string, fn func(trigram)) {
+	for n := 0; n+3 <= len(s); n++ {
+		fn(trigram{s[n], s[n+1], s[n+2]})
+	}
+}
+
+func (s *searchIndex) update(dir string, entries []Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeDocs(dir)
+	ids := make([]uint32, 0, len(entries))
+	for _, e := range entries {
+		id := s.nextID
+		s.nextID++
+		doc := &searchDoc{
+			dir:   dir,
+			entry: e,
+			lower: strings.ToLower(e.Name),
+		}
+		s.docs[id] = doc
+		trigrams(doc.lower, func(t trigram) {
+			p, ok := s.postings[t]
+			if !ok {
+				p = make(map[uint32]struct{})
+				s.postings[t] = p
+			}
+			p[id] = struct{}{}
+		})
+		ids = append(ids, id)
+	}
+	s.byDir[dir] = ids
+}
+
+func (s *searchIndex) remove(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for d := range s.byDir {
+		if d == dir || strings.HasPrefix(d, dir+"/") || dir == "." {
+			s.removeDocs(d)
+		}
+	}
+}
+
+// Caller must hold s.mu
+func (s *searchIndex) removeDocs(dir string) {
+	for _, id := range s.byDir[dir] {
+		doc := s.docs[id]
+		trigrams(doc.lower, func(t trigram) {
+			p := s.postings[t]
+			delete(p, id)
+			if len(p) == 0 {
+				delete(s.postings, t)
+			}
+		})
+		delete(s.docs, id)
+	}
+	delete(s.byDir, dir)
+}
+
+// Docs whose names may contain the lower case substring q
+// Caller must hold s.mu
+func (s *searchIndex) candidates(q string) map[uint32]*searchDoc {
+	if len(q) < 3 {
+		return s.docs
+	}
+	var smallest map[uint32]struct{}
+	var missing bool
+	trigrams(q, func(t trigram) {
+		p := s.postings[t]
+		if len(p) == 0 {
+			missing = true
+		}
+		if smallest == nil || len(p) < len(smallest) {
+			smallest = p
+		}
+	})
+	docs := make(map[uint32]*searchDoc)
+	if missing {
+		return docs
+	}
+	for id := range smallest {
+		docs[id] = s.docs[id]
+	}
+	return docs
+}
+
+func (s *searchIndex) search(opts SearchOptions, limit int) (SearchResponse, error) {
+	var match func(doc *searchDoc) bool
+	q := strings.ToLower(opts.Query)
+	switch opts.Mode {
+	case "", SearchSubstring:
+		match = func(doc *searchDoc) bool {
+			return strings.Contains(doc.lower, q)
+		}
+	case SearchGlob:
+		_, err := path.Match(opts.Query, "")
+		if err != nil {
+			return SearchResponse{}, fmt.Errorf("invalid glob: %w", err)
+		}
+		// Patterns with a slash match the path
+		full := strings.Contains(opts.Query, "/")
+		match = func(doc *searchDoc) bool {
+			name := doc.entry.Name
+			if full {
+				name = docPath(doc)
+			}
+			ok, _ := path.Match(opts.Query, name)
+			return ok
+		}
+		q = ""
+	case SearchRegexp:
+		re, err := regexp.Compile(opts.Query)
+		if err != nil {
+			return SearchResponse{}, fmt.Errorf("invalid regex: %w", err)
+		}
+		match = func(doc *searchDoc) bool {
+			return re.MatchString(doc.entry.Name)
+		}
+		q = ""
+	default:
+		return SearchResponse{}, fmt.Errorf("invalid mode %q", opts.Mode)
+	}
+
+	s.mu.RLock()
+	var results []SearchResult
+	for _, doc := range s.candidates(q) {
+		if match(doc) {
+			results = append(results, SearchResult{
+				Path:  docPath(doc),
+				Entry: doc.entry,
+			})
+		}
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(results, func(a, b SearchResult) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	resp := SearchResponse{Results: results}
+	if len(results) > limit {
+		resp.Results = results[:limit]
+		resp.Truncated = true
+	}
+	if resp.Results == nil {
+		resp.Results = []SearchResult{}
+	}
+	return resp, nil
+}
+
+func docPath(doc *searchDoc) string {
+	if doc.dir == "." {
+		return "/" + doc.entry.Name
+	}
+	return "/" + doc.dir + "/" + doc.entry.Name
+}
+
+// Search finds entries anywhere below the root by name. Results are in path
+// order and reflect the filesystem as of the last crawl.
+func (i *Index) Search(opts SearchOptions) (SearchResponse, error) {
+	if i.searcher == nil {
+		return SearchResponse{}, ErrSearchDisabled
+	}
+	limit := i.search.MaxResults
+	if opts.Limit > 0 {
+		limit = min(opts.Limit, limit)
+	}
+	return i.searcher.search(opts, limit)
+}
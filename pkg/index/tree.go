@@ -0,0 +1,81 @@
+package index
+
+import (
+	"path/filepath"
+	"slices"
+
+	"github.com/bytedance/sonic"
+)
+
+// Directory entry awaiting expansion
+type treeNode struct {
+	path  string
+	entry *Entry
+	depth int
+}
+
+// Fill in children of the directories in contents, breadth first, up to
+// opts.Depth levels and the tree entry limit. Listings come from the cache
+// where available. Returns the expanded directories and whether the limit
+// cut the tree short.
+func (i *Index) expand(path string, contents []Entry, opts QueryOptions) ([]string, bool) {
+	budget := i.maxTreeEntries - len(contents)
+	var expanded []string
+	var queue []treeNode
+	enqueue := func(dir string, entries []Entry, depth int) {
+		for n := range entries {
+			if entries[n].Type == TypeDir && depth <= opts.Depth {
+				queue = append(queue, treeNode{dir + "/" + entries[n].Name, &entries[n], depth})
+			}
+		}
+	}
+	enqueue(path, contents, 1)
+
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		if budget <= 0 {
+			return expanded, true
+		}
+
+		result, ok := i.query(node.path, opts.Fields)
+		if !ok {
+			continue
+		}
+		var resp Response
+		err := sonic.Unmarshal(result.Body, &resp)
+		if err != nil {
+			i.logger.Errorf("response unmarshal failed: %v", err)
+			continue
+		}
+		if resp.Type != TypeDir {
+			continue
+		}
+
+		children := resp.Contents
+		slices.SortStableFunc(children, opts.compare)
+		truncated := len(children) > budget
+		if truncated {
+			children = children[:budget]
+		}
+		budget -= len(children)
+		node.entry.Children = children
+		expanded = append(expanded, node.path)
+		if truncated {
+			return expanded, true
+		}
+
+		enqueue(node.path, children, node.depth+1)
+	}
+	return expanded, false
+}
+
+// Track the tree cached under key for changes in all expanded directories
+func (i *Index) trackTree(key string, expanded []string) {
+	if i.watcher == nil {
+		return
+	}
+	for _, dir := range expanded {
+		i.watcher.track(filepath.Join(i.root, dir), key, true)
+	}
+}
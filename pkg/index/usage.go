@@ -0,0 +1,139 @@
+package index
+
+import (
+	"path"
+	"sync"
+	"time"
+)
+
+// Usage configures the background aggregation of directory sizes. Listings
+// include the totals of directories once their whole subtree was crawled.
+type Usage struct {
+	Interval time.Duration // Between full crawls, defaults to an hour
+}
+
+// Totals of the files in a directory
+type dirUsage struct {
+	size   int64
+	files  int64
+	newest int64 // Unix timestamp
+}
+
+func (u *dirUsage) add(o dirUsage) {
+	u.size += o.size
+	u.files += o.files
+	u.newest = max(u.newest, o.newest)
+}
+
+type usageDir struct {
+	local    dirUsage            // Files directly inside
+	subdirs  map[string]struct{} // Names of subdirectories
+	total    dirUsage            // Including subdirectories
+	complete bool                // Whether all subdirectories are crawled
+}
+
+// Aggregates directory usage from the crawler, like du
+type aggregator struct {
+	mu   sync.RWMutex
+	dirs map[string]*usageDir // Root relative name -> usage
+}
+
+func newAggregator() *aggregator {
+	return &aggregator{
+		dirs: make(map[string]*usageDir),
+	}
+}
+
+// Recursive totals of directory name, if known
+func (a *aggregator) get(name string) (dirUsage, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	d, ok := a.dirs[name]
+	if !ok || !d.complete {
+		return dirUsage{}, false
+	}
+	return d.total, true
+}
+
+func (a *aggregator) update(dir string, entries []Entry) {
+	var local dirUsage
+	subdirs := make(map[string]struct{})
+	for _, e := range entries {
+		if e.Type == TypeDir {
+			subdirs[e.Name] = struct{}{}
+			continue
+		}
+		local.add(dirUsage{
+			size:   e.Size,
+			files:  1,
+			newest: e.MTime,
+		})
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	d, ok := a.dirs[dir]
+	if !ok {
+		d = &usageDir{}
+		a.dirs[dir] = d
+	}
+	d.local = local
+	d.subdirs = subdirs
+	a.recompute(dir)
+}
+
+func (a *aggregator) remove(dir string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.removeTree(dir)
+	if dir != "." {
+		a.recompute(path.Dir(dir))
+	}
+}
+
+// Caller must hold a.mu
+func (a *aggregator) removeTree(name string) {
+	d, ok := a.dirs[name]
+	if !ok {
+		return
+	}
+	for sub := range d.subdirs {
+		a.removeTree(path.Join(name, sub))
+	}
+	delete(a.dirs, name)
+}
+
+// Update the totals of directory name and its parents. Caller must hold a.mu.
+func (a *aggregator) recompute(name string) {
+	for {
+		d, ok := a.dirs[name]
+		if !ok {
+			return
+		}
+		d.total = d.local
+		d.complete = true
+		for sub := range d.subdirs {
+			s, ok := a.dirs[path.Join(name, sub)]
+			if !ok || !s.complete {
+				d.complete = false
+				continue
+			}
+			d.total.add(s.total)
+		}
+		if name == "." {
+			return
+		}
+		name = path.Dir(name)
+	}
+}
+
+// Aggregated usage of directory name, if known
+func (i *Index) dirUsage(name string) (dirUsage, bool) {
+	if i.aggregator == nil {
+		return dirUsage{}, false
+	}
+	return i.aggregator.get(name)
+}
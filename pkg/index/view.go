@@ -0,0 +1,246 @@
+package index
+
+import (
+	"cmp"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+const (
+	SortName  = "name"
+	SortMTime = "mtime"
+	SortSize  = "size"
+	SortType  = "type"
+)
+
+// QueryOptions select a view of a directory listing. The zero value selects
+// the listing as read from the filesystem, in filename order.
+type QueryOptions struct {
+	Sort      string // One of the Sort constants, empty sorts by name
+	Desc      bool
+	DirsFirst bool
+
+	// Entries to keep. Filtered views are computed from the cached
+	// listing on every query.
+	Filter Filter
+
+	// Page of the listing, a zero Limit leaves it unlimited
+	Offset int
+	Limit  int
+
+	// Levels of subdirectories whose contents are nested in the listing.
+	// Filters and pages apply to the top level only.
+	Depth int
+
+	// Extended metadata of entries
+	Fields Fields
+}
+
+// Filter selects entries of a listing. Zero fields match everything.
+type Filter struct {
+	Match     string         // Glob matched against names
+	Regexp    *regexp.Regexp // Matched against names
+	Type      string         // One of the Type constants
+	MinSize   int64          // Only files have a size
+	NewerThan time.Time
+}
+
+func (f Filter) empty() bool {
+	return f.Match == "" && f.Regexp == nil && f.Type == "" && f.MinSize == 0 && f.NewerThan.IsZero()
+}
+
+func (f Filter) matches(e Entry) bool {
+	if f.Match != "" {
+		ok, _ := path.Match(f.Match, e.Name)
+		if !ok {
+			return false
+		}
+	}
+	if f.Regexp != nil && !f.Regexp.MatchString(e.Name) {
+		return false
+	}
+	if f.Type != "" && e.Type != f.Type {
+		return false
+	}
+	if f.MinSize > 0 && (e.Type != TypeFile || e.Size < f.MinSize) {
+		return false
+	}
+	if !f.NewerThan.IsZero() && e.MTime <= f.NewerThan.Unix() {
+		return false
+	}
+	return true
+}
+
+// Suffix distinguishing the cache key of the view, empty for the default
+func (o QueryOptions) variant() string {
+	var sb strings.Builder
+	if o.Sort != "" && o.Sort != SortName {
+		sb.WriteString("sort=" + o.Sort + ";")
+	}
+	if o.Desc {
+		sb.WriteString("desc;")
+	}
+	if o.DirsFirst {
+		sb.WriteString("dirs_first;")
+	}
+	if o.paged() {
+		fmt.Fprintf(&sb, "offset=%d;limit=%d;", o.Offset, o.Limit)
+	}
+	if o.Depth > 0 {
+		fmt.Fprintf(&sb, "depth=%d;", o.Depth)
+	}
+	if o.Fields != 0 {
+		fmt.Fprintf(&sb, "fields=%d;", o.Fields)
+	}
+	return sb.String()
+}
+
+func (o QueryOptions) paged() bool {
+	return o.Offset > 0 || o.Limit > 0
+}
+
+func (o QueryOptions) apply(resp *Response) {
+	slices.SortStableFunc(resp.Contents, o.compare)
+
+	if !o.Filter.empty() {
+		resp.Contents = slices.DeleteFunc(resp.Contents, func(e Entry) bool {
+			return !o.Filter.matches(e)
+		})
+	}
+
+	if !o.paged() {
+		return
+	}
+	resp.Total = len(resp.Contents)
+	start := min(o.Offset, resp.Total)
+	end := resp.Total
+	if o.Limit > 0 && start+o.Limit < resp.Total {
+		end = start + o.Limit
+		resp.NextCursor = EncodeCursor(end)
+	}
+	resp.Contents = resp.Contents[start:end]
+}
+
+func (o QueryOptions) compare(a, b Entry) int {
+	if o.DirsFirst && (a.Type == TypeDir) != (b.Type == TypeDir) {
+		if a.Type == TypeDir {
+			return -1
+		}
+		return 1
+	}
+
+	var c int
+	switch o.Sort {
+	case SortMTime:
+		c = cmp.Compare(a.MTime, b.MTime)
+	case SortSize:
+		c = cmp.Compare(a.Size, b.Size)
+	case SortType:
+		c = strings.Compare(a.Type, b.Type)
+	}
+	if c == 0 {
+		c = strings.Compare(a.Name, b.Name)
+	}
+	if o.Desc {
+		return -c
+	}
+	return c
+}
+
+// QueryWithOptions is QueryBytes for the view of a listing selected by opts.
+// Views are derived from the cached listing and, unless filtered, cached
+// alongside it. Depth is capped at the index's maximum.
+func (i *Index) QueryWithOptions(path string, opts QueryOptions) ([]byte, bool) {
+	result, ok := i.QueryResult(path, opts)
+	return result.Body, ok
+}
+
+// QueryResult is QueryWithOptions returning validators of the view along
+// with it, for answering conditional requests.
+func (i *Index) QueryResult(path string, opts QueryOptions) (Result, bool) {
+	path = strings.TrimSuffix(path, "/")
+	opts.Depth = min(opts.Depth, i.maxDepth)
+	variant := opts.variant()
+	cacheable := opts.Filter.empty()
+	if variant == (QueryOptions{Fields: opts.Fields}).variant() && cacheable {
+		// Listing as read from the filesystem
+		return i.query(path, opts.Fields)
+	}
+
+	key := path + "\x00" + variant
+	if cacheable {
+		result, ok := i.queryCache(key)
+		if ok {
+			return result, true
+		}
+	}
+
+	read := i.beginRead(path)
+	defer read.end()
+	result, ok := i.query(path, opts.Fields)
+	if !ok {
+		return Result{}, false
+	}
+
+	var resp Response
+	err := sonic.Unmarshal(result.Body, &resp)
+	if err != nil {
+		i.logger.Errorf("response unmarshal failed: %v", err)
+		return Result{}, false
+	}
+	if resp.Type != TypeDir {
+		// Nothing to order or page
+		return result, true
+	}
+
+	opts.apply(&resp)
+
+	var expanded []string
+	if opts.Depth > 0 {
+		expanded, resp.Truncated = i.expand(path, resp.Contents, opts)
+	}
+
+	respBytes, err := sonic.Marshal(resp)
+	if err != nil {
+		i.logger.Errorf("error marshaling response json")
+		return Result{}, false
+	}
+
+	header := i.newHeader(respBytes, resp.lastModified())
+	if !cacheable {
+		// Filtered from the listing, cached if the listing was
+		view := header.result("", respBytes)
+		view.Cached = result.Cached
+		return view, true
+	}
+	read.store(key, respBytes, header)
+	i.trackTree(key, expanded)
+	return header.result(key, respBytes), true
+}
+
+// EncodeCursor returns an opaque cursor for the page starting at offset
+func EncodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// DecodeCursor returns the offset of the page a cursor points to
+func DecodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("malformed cursor")
+	}
+	offset, err := strconv.Atoi(string(b))
+	if err != nil || offset < 0 {
+		return 0, errors.New("malformed cursor")
+	}
+	return offset, nil
+}
@@ -0,0 +1,240 @@
+package index
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Evicts cached responses when the filesystem entries behind them change
+type watcher struct {
+	index *Index
+	fsw   *fsnotify.Watcher
+
+	mu      sync.Mutex
+	paths   map[string]*trackedPath // Filesystem path -> cache keys
+	watched map[string]int          // Watched directory -> tracked paths in it
+
+	done chan struct{}
+}
+
+type trackedPath struct {
+	keys      map[string]struct{}
+	dir       string // Directory watched on behalf of this path
+	expiresAt time.Time
+	reads     int    // Reads started with begin and not yet ended
+	changes   uint64 // Events seen while reads were in progress
+}
+
+func newWatcher(index *Index) (*watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &watcher{
+		index:   index,
+		fsw:     fsw,
+		paths:   make(map[string]*trackedPath),
+		watched: make(map[string]int),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Record that key caches the response for name. Directories are watched
+// themselves, files through their parent.
+func (w *watcher) track(name string, key string, isDir bool) {
+	name = filepath.Clean(name)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	tp := w.watch(name, isDir)
+	if tp == nil {
+		return
+	}
+	tp.keys[key] = struct{}{}
+	tp.expiresAt = time.Now().Add(w.index.ttl)
+}
+
+// Watch name ahead of reading it, so changes made during the read aren't
+// missed. Returns the change count to pass to commit, false if name can't
+// be watched. Every successful begin must be followed by commit or end.
+func (w *watcher) begin(name string, isDir bool) (uint64, bool) {
+	name = filepath.Clean(name)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	tp := w.watch(name, isDir)
+	if tp == nil {
+		return 0, false
+	}
+	tp.reads++
+	return tp.changes, true
+}
+
+// Record that key caches the read of name started with begin. Reports
+// false without recording it if name changed since.
+func (w *watcher) commit(name string, key string, changes uint64) bool {
+	name = filepath.Clean(name)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	tp := w.paths[name]
+	tp.reads--
+	if tp.changes != changes {
+		w.release(name, tp)
+		return false
+	}
+	tp.keys[key] = struct{}{}
+	tp.expiresAt = time.Now().Add(w.index.ttl)
+	return true
+}
+
+// End a read of name started with begin without caching it
+func (w *watcher) end(name string) {
+	name = filepath.Clean(name)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	tp := w.paths[name]
+	tp.reads--
+	w.release(name, tp)
+}
+
+// Returns the tracked path for name, watching it if needed. Caller must
+// hold w.mu.
+func (w *watcher) watch(name string, isDir bool) *trackedPath {
+	tp, ok := w.paths[name]
+	if ok {
+		return tp
+	}
+	dir := name
+	if !isDir {
+		dir = filepath.Dir(name)
+	}
+	if w.watched[dir] == 0 {
+		err := w.fsw.Add(dir)
+		if err != nil {
+			w.index.logger.Warnf("error watching %s: %v", dir, err)
+			return nil
+		}
+		w.index.logger.Debugf("watching %s", dir)
+	}
+	w.watched[dir]++
+	tp = &trackedPath{
+		keys: make(map[string]struct{}),
+		dir:  dir,
+	}
+	w.paths[name] = tp
+	return tp
+}
+
+// Evict every cache key recorded for name
+func (w *watcher) evict(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	tp, ok := w.paths[name]
+	if !ok {
+		return
+	}
+	for key := range tp.keys {
+		w.index.logger.Debugf("evicting \"%s\"", key)
+		w.index.cache.Delete(key)
+	}
+	clear(tp.keys)
+	tp.changes++
+	w.release(name, tp)
+}
+
+// Untrack name unless reads of it are in progress. Caller must hold w.mu.
+func (w *watcher) release(name string, tp *trackedPath) {
+	if tp.reads == 0 && len(tp.keys) == 0 {
+		w.untrack(name, tp)
+	}
+}
+
+// Caller must hold w.mu
+func (w *watcher) untrack(name string, tp *trackedPath) {
+	delete(w.paths, name)
+	w.watched[tp.dir]--
+	if w.watched[tp.dir] <= 0 {
+		delete(w.watched, tp.dir)
+		// Fails harmlessly if the directory is already gone
+		w.fsw.Remove(tp.dir)
+	}
+}
+
+// Drop paths whose cache entries have expired anyway
+func (w *watcher) sweep() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	for name, tp := range w.paths {
+		if tp.reads == 0 && now.After(tp.expiresAt) {
+			w.untrack(name, tp)
+		}
+	}
+}
+
+func (w *watcher) run() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			w.index.logger.Warnf("watcher error: %v", err)
+		case <-ticker.C:
+			w.sweep()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *watcher) handle(event fsnotify.Event) {
+	if event.Op == fsnotify.Chmod {
+		return
+	}
+	w.index.logger.Debugf("watch event: %s", event)
+
+	// The entry itself and the listing containing it
+	name := filepath.Clean(event.Name)
+	parent := filepath.Dir(name)
+	w.evict(name)
+	w.evict(parent)
+	if w.index.crawler != nil {
+		rel, err := filepath.Rel(w.index.root, parent)
+		if err == nil {
+			w.index.crawler.touch(filepath.ToSlash(rel))
+		}
+	}
+
+	// Adding or removing an entry also changes the parent's mtime, which is
+	// part of the grandparent's listing
+	if event.Has(fsnotify.Create) || event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		w.evict(filepath.Dir(parent))
+	}
+}
+
+func (w *watcher) Close() error {
+	close(w.done)
+	return w.fsw.Close()
+}
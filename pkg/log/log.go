@@ -2,6 +2,7 @@ package log
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"time"
 
@@ -13,6 +14,8 @@ type Logger interface {
 	Infof(format string, a ...any)
 	Warnf(format string, a ...any)
 	Errorf(format string, a ...any)
+	// With returns a Logger adding key/value pairs to every message
+	With(args ...any) Logger
 }
 
 type LogLevel int
@@ -25,6 +28,13 @@ const (
 	Debug
 )
 
+// LevelWriter is an output recording the severity of every message written
+// to it, like syslog. Loggers write to it with WriteLevel.
+type LevelWriter interface {
+	io.Writer
+	WriteLevel(level LogLevel, p []byte) (int, error)
+}
+
 var (
 	errorTagBytes = []byte(" [ERROR] ")
 	warnTagBytes  = []byte(" [WARN] ")
@@ -32,44 +42,66 @@ var (
 	debugTagBytes = []byte(" [DEBUG] ")
 )
 
+// SimpleLogger writes plain lines, fields follow the message as key=value
 type SimpleLogger struct {
-	Level LogLevel
+	Level  LogLevel
+	Out    io.Writer // Defaults to stdout
+	fields []any
 }
 
 func (l *SimpleLogger) Debugf(format string, a ...any) {
 	if l.Level >= Debug {
-		logf(debugTagBytes, format, a...)
+		l.logf(Debug, debugTagBytes, format, a...)
 	}
 }
 
 func (l *SimpleLogger) Infof(format string, a ...any) {
 	if l.Level >= Info {
-		logf(infoTagBytes, format, a...)
+		l.logf(Info, infoTagBytes, format, a...)
 	}
 }
 
 func (l *SimpleLogger) Warnf(format string, a ...any) {
 	if l.Level >= Warn {
-		logf(warnTagBytes, format, a...)
+		l.logf(Warn, warnTagBytes, format, a...)
 	}
 }
 
 func (l *SimpleLogger) Errorf(format string, a ...any) {
 	if l.Level >= Error {
-		logf(errorTagBytes, format, a...)
+		l.logf(Error, errorTagBytes, format, a...)
+	}
+}
+
+func (l *SimpleLogger) With(args ...any) Logger {
+	return &SimpleLogger{
+		Level:  l.Level,
+		Out:    l.Out,
+		fields: append(l.fields[:len(l.fields):len(l.fields)], args...),
 	}
 }
 
-func logf(levelTag []byte, format string, a ...any) {
+func (l *SimpleLogger) logf(level LogLevel, levelTag []byte, format string, a ...any) {
 	bb := bytebufferpool.Get()
 	defer bytebufferpool.Put(bb)
 
 	bb.WriteString(time.Now().Format(time.RFC3339))
 	bb.Write(levelTag)
 	fmt.Fprintf(bb, format, a...)
+	for n := 0; n+1 < len(l.fields); n += 2 {
+		fmt.Fprintf(bb, " %v=%v", l.fields[n], l.fields[n+1])
+	}
 	bb.WriteByte('\n')
 
-	bb.WriteTo(os.Stdout)
+	out := l.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	if lw, ok := out.(LevelWriter); ok {
+		lw.WriteLevel(level, bb.B)
+		return
+	}
+	bb.WriteTo(out)
 }
 
 type DiscardLogger struct {
@@ -86,3 +118,7 @@ func (l *DiscardLogger) Warnf(format string, a ...any) {
 
 func (l *DiscardLogger) Errorf(format string, a ...any) {
 }
+
+func (l *DiscardLogger) With(args ...any) Logger {
+	return l
+}
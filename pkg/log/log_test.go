@@ -0,0 +1,130 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSimpleLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := &SimpleLogger{Level: Info, Out: &b}
+	l.With("component", "index").With("n", 1).Infof("hello %s", "world")
+	l.Debugf("dropped")
+	if got := b.String(); !strings.HasSuffix(got, " [INFO] hello world component=index n=1\n") {
+		t.Errorf("unexpected line %q", got)
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := NewJSONLogger(&b, Warn)
+	l.Infof("dropped")
+	l.With("component", "index").Errorf("error %d", 42)
+
+	var line map[string]any
+	err := json.Unmarshal(b.Bytes(), &line)
+	if err != nil {
+		t.Fatalf("invalid line %q: %v", b.String(), err)
+	}
+	if line["level"] != "ERROR" || line["msg"] != "error 42" || line["component"] != "index" {
+		t.Errorf("unexpected line %v", line)
+	}
+
+	b.Reset()
+	NewJSONLogger(&b, None).Errorf("dropped")
+	if b.Len() != 0 {
+		t.Errorf("unexpected line %q at level none", b.String())
+	}
+}
+
+// Records the level of every write
+type levelBuffer struct {
+	bytes.Buffer
+	levels []LogLevel
+}
+
+func (b *levelBuffer) WriteLevel(level LogLevel, p []byte) (int, error) {
+	b.levels = append(b.levels, level)
+	return b.Write(p)
+}
+
+func TestLevelWriter(t *testing.T) {
+	exp := []LogLevel{Error, Warn, Info, Debug}
+	for name, l := range map[string]func(*levelBuffer) Logger{
+		"simple": func(b *levelBuffer) Logger { return &SimpleLogger{Level: Debug, Out: b} },
+		"json":   func(b *levelBuffer) Logger { return NewJSONLogger(b, Debug).With("k", "v") },
+	} {
+		var b levelBuffer
+		logger := l(&b)
+		logger.Errorf("error")
+		logger.Warnf("warn")
+		logger.Infof("info")
+		logger.Debugf("debug")
+		if !slices.Equal(b.levels, exp) {
+			t.Errorf("%s: expected levels %v, got %v", name, exp, b.levels)
+		}
+		if name == "json" && !strings.Contains(b.String(), `"k":"v"`) {
+			t.Errorf("%s: missing field in %q", name, b.String())
+		}
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autoindex.log")
+	f, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("open error: %v", err)
+	}
+	for _, line := range []string{"1111\n", "2222\n", "3333\n", "4444\n", "5555\n", "6666\n", "7777\n"} {
+		_, err = f.Write([]byte(line))
+		if err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	for name, exp := range map[string]string{
+		path:        "7777\n",
+		path + ".1": "5555\n6666\n",
+		path + ".2": "3333\n4444\n",
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Errorf("read error: %v", err)
+			continue
+		}
+		if string(data) != exp {
+			t.Errorf("%s: expected %q, got %q", filepath.Base(name), exp, data)
+		}
+	}
+	_, err = os.Stat(path + ".3")
+	if !os.IsNotExist(err) {
+		t.Errorf("expected no third backup, got %v", err)
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	var a, b bytes.Buffer
+	s := NewSwitch(&SimpleLogger{Level: Info, Out: &a})
+	child := s.With("component", "index")
+	child.Infof("first")
+	s.Set(&SimpleLogger{Level: Info, Out: &b})
+	child.Infof("second")
+	s.Infof("third")
+
+	if !strings.HasSuffix(a.String(), " [INFO] first component=index\n") {
+		t.Errorf("unexpected first output %q", a.String())
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], " second component=index") || !strings.HasSuffix(lines[1], " [INFO] third") {
+		t.Errorf("unexpected second output %q", b.String())
+	}
+}
@@ -0,0 +1,128 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// SlogLogger adapts a log/slog Logger, messages are formatted before being
+// handed to it
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	return &SlogLogger{logger: logger}
+}
+
+// NewJSONLogger writes a JSON object per line to w, at the level of the
+// message if w is a LevelWriter
+func NewJSONLogger(w io.Writer, level LogLevel) *SlogLogger {
+	opts := &slog.HandlerOptions{
+		Level: slogLevel(level),
+	}
+	lw, ok := w.(LevelWriter)
+	if !ok {
+		return NewSlogLogger(slog.New(slog.NewJSONHandler(w, opts)))
+	}
+	var h levelHandler
+	for l := Error; l <= Debug; l++ {
+		h[l] = slog.NewJSONHandler(levelWriter{lw, l}, opts)
+	}
+	return NewSlogLogger(slog.New(h))
+}
+
+// Writes everything at one level
+type levelWriter struct {
+	w     LevelWriter
+	level LogLevel
+}
+
+func (w levelWriter) Write(p []byte) (int, error) {
+	return w.w.WriteLevel(w.level, p)
+}
+
+// Hands records to the handler writing at their level, indexed by LogLevel
+type levelHandler [Debug + 1]slog.Handler
+
+func (h levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h[logLevel(level)].Enabled(ctx, level)
+}
+
+func (h levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h[logLevel(r.Level)].Handle(ctx, r)
+}
+
+func (h levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	for l := range h {
+		h[l] = h[l].WithAttrs(attrs)
+	}
+	return h
+}
+
+func (h levelHandler) WithGroup(name string) slog.Handler {
+	for l := range h {
+		h[l] = h[l].WithGroup(name)
+	}
+	return h
+}
+
+func logLevel(level slog.Level) LogLevel {
+	switch {
+	case level >= slog.LevelError:
+		return Error
+	case level >= slog.LevelWarn:
+		return Warn
+	case level >= slog.LevelInfo:
+		return Info
+	default:
+		return Debug
+	}
+}
+
+func slogLevel(level LogLevel) slog.Level {
+	switch level {
+	case Debug:
+		return slog.LevelDebug
+	case Info:
+		return slog.LevelInfo
+	case Warn:
+		return slog.LevelWarn
+	case Error:
+		return slog.LevelError
+	default:
+		// Above every level logged
+		return slog.LevelError + 1
+	}
+}
+
+func (l *SlogLogger) Debugf(format string, a ...any) {
+	l.logf(slog.LevelDebug, format, a...)
+}
+
+func (l *SlogLogger) Infof(format string, a ...any) {
+	l.logf(slog.LevelInfo, format, a...)
+}
+
+func (l *SlogLogger) Warnf(format string, a ...any) {
+	l.logf(slog.LevelWarn, format, a...)
+}
+
+func (l *SlogLogger) Errorf(format string, a ...any) {
+	l.logf(slog.LevelError, format, a...)
+}
+
+func (l *SlogLogger) With(args ...any) Logger {
+	return &SlogLogger{logger: l.logger.With(args...)}
+}
+
+func (l *SlogLogger) logf(level slog.Level, format string, a ...any) {
+	ctx := context.Background()
+	// Skip formatting messages that would be dropped
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	l.logger.Log(ctx, level, fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,67 @@
+package log
+
+import "sync/atomic"
+
+// Switch forwards to a Logger that can be replaced while in use, also from
+// the Loggers derived from it with With
+type Switch struct {
+	current *atomic.Pointer[target] // Shared with derived Switches
+	fields  []any
+	derived atomic.Pointer[derived] // current.With(fields...), built lazily
+}
+
+type target struct {
+	Logger
+}
+
+type derived struct {
+	base   *target
+	logger Logger
+}
+
+func NewSwitch(l Logger) *Switch {
+	s := &Switch{current: &atomic.Pointer[target]{}}
+	s.Set(l)
+	return s
+}
+
+// Set replaces the Logger of s and every Switch derived from it
+func (s *Switch) Set(l Logger) {
+	s.current.Store(&target{l})
+}
+
+func (s *Switch) logger() Logger {
+	base := s.current.Load()
+	if len(s.fields) == 0 {
+		return base.Logger
+	}
+	if d := s.derived.Load(); d != nil && d.base == base {
+		return d.logger
+	}
+	d := &derived{base: base, logger: base.With(s.fields...)}
+	s.derived.Store(d)
+	return d.logger
+}
+
+func (s *Switch) Debugf(format string, a ...any) {
+	s.logger().Debugf(format, a...)
+}
+
+func (s *Switch) Infof(format string, a ...any) {
+	s.logger().Infof(format, a...)
+}
+
+func (s *Switch) Warnf(format string, a ...any) {
+	s.logger().Warnf(format, a...)
+}
+
+func (s *Switch) Errorf(format string, a ...any) {
+	s.logger().Errorf(format, a...)
+}
+
+func (s *Switch) With(args ...any) Logger {
+	return &Switch{
+		current: s.current,
+		fields:  append(s.fields[:len(s.fields):len(s.fields)], args...),
+	}
+}
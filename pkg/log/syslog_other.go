@@ -0,0 +1,12 @@
+//go:build !unix
+
+package log
+
+import (
+	"errors"
+	"io"
+)
+
+func DialSyslog(network string, addr string, tag string) (io.WriteCloser, error) {
+	return nil, errors.New("syslog not supported on this platform")
+}
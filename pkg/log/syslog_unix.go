@@ -0,0 +1,41 @@
+//go:build unix
+
+package log
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// DialSyslog connects to the syslog server at addr over network, or the
+// local one if both are empty. The connection is a LevelWriter, plain
+// writes are sent at info severity.
+func DialSyslog(network string, addr string, tag string) (io.WriteCloser, error) {
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return syslogWriter{w}, nil
+}
+
+type syslogWriter struct {
+	*syslog.Writer
+}
+
+func (w syslogWriter) WriteLevel(level LogLevel, p []byte) (int, error) {
+	var err error
+	switch level {
+	case Error:
+		err = w.Err(string(p))
+	case Warn:
+		err = w.Warning(string(p))
+	case Debug:
+		err = w.Debug(string(p))
+	default:
+		err = w.Info(string(p))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}